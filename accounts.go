@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Rounds of PBKDF2 for account passwords
+const PASSWORD_ROUNDS int = 100000
+
+const MIN_PASSWORD_LENGTH int = 6
+
+// Wrong passwords before the server hangs up
+const MAX_LOGIN_FAILURES int = 3
+
+const PASSWORD_MSG string = "prompt.password"
+
+// An Account reserves a nickname across every game for whoever knows its
+// password
+type Account struct {
+	Name string
+	Salt []byte
+	Hash []byte
+}
+
+// An AccountStore with no Path keeps its accounts in memory
+type AccountStore struct {
+	Path     string
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+var Accounts *AccountStore = NewAccountStore(GetAccountFile())
+
+func GetAccountFile() string {
+	path := os.Getenv("ACCOUNTS_FILE")
+	if path == "" {
+		path = "accounts.json"
+	}
+	return path
+}
+
+func NewAccountStore(path string) *AccountStore {
+	return &AccountStore{Path: path}
+}
+
+func (s *AccountStore) load() {
+	if s.accounts != nil {
+		return
+	}
+	s.accounts = make(map[string]*Account)
+	if s.Path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading accounts: %s", err.Error())
+		}
+		return
+	}
+	accounts := make(map[string]*Account)
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		log.Printf("Error parsing accounts: %s", err.Error())
+	}
+	for name, a := range accounts {
+		s.accounts[AccountKey(name)] = a
+	}
+}
+
+// AccountKey is what name is stored under, accounts don't tell "Alice"
+// from "alice"
+func AccountKey(name string) string {
+	return strings.ToLower(name)
+}
+
+func (s *AccountStore) save() error {
+	if s.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.accounts, "", "\t")
+	if err != nil {
+		return err
+	}
+	// Only the server should read the password hashes
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
+
+// Registered reports whether name belongs to an account
+func (s *AccountStore) Registered(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	_, ok := s.accounts[AccountKey(name)]
+	return ok
+}
+
+// Register creates an account for name. The password is hashed without
+// holding the store, so logins elsewhere don't wait for it.
+func (s *AccountStore) Register(name string, password string) error {
+	if len(password) < MIN_PASSWORD_LENGTH {
+		return T("account.short_password", MIN_PASSWORD_LENGTH)
+	}
+	if s.Registered(name) {
+		return T("account.taken")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password, salt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := AccountKey(name)
+	// Someone else may have taken it while hashing
+	if _, ok := s.accounts[key]; ok {
+		return T("account.taken")
+	}
+	s.accounts[key] = &Account{Name: name, Salt: salt, Hash: hash}
+	if err := s.save(); err != nil {
+		delete(s.accounts, key)
+		return err
+	}
+	return nil
+}
+
+// Verify reports whether password is right for the account name
+func (s *AccountStore) Verify(name string, password string) bool {
+	s.mu.Lock()
+	s.load()
+	a, ok := s.accounts[AccountKey(name)]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	hash, err := hashPassword(password, a.Salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, a.Hash) == 1
+}
+
+func hashPassword(password string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, password, salt, PASSWORD_ROUNDS, 32)
+}
+
+// Register creates an account for the player's nickname, so nobody else can
+// use it in any game
+func (c *Client) Register(password string) {
+	if c.Account != "" {
+		c.Tell("account.logged_in", c.Account)
+		return
+	}
+	// Hashing the password takes a while, the game goes on meanwhile
+	g, name := c.Game, c.Name
+	go func() {
+		err := g.Accounts.Register(name, password)
+		if err == nil {
+			log.Printf("Registered account %s", name)
+		}
+		g.Post(func() {
+			if g.Clients[name] != c {
+				return
+			}
+			if err != nil {
+				c.Tell("account.register_failed", name, err)
+				return
+			}
+			c.Account = AccountKey(name)
+			c.Tell("account.registered", name)
+		}, nil)
+	}()
+}
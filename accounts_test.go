@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccountStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goph3r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+
+	store := NewAccountStore(path)
+	if err := store.Register("alice", "short"); err == nil {
+		t.Fatalf("Expected a short password to be refused")
+	}
+	if err := store.Register("alice", "hunter22"); err != nil {
+		t.Fatalf("Error registering: %s", err.Error())
+	}
+	if err := store.Register("Alice", "another1"); err == nil {
+		t.Fatalf("Expected a name to be registered only once, whatever its case")
+	}
+
+	// Accounts survive a restart
+	store = NewAccountStore(path)
+	if !store.Registered("alice") || store.Registered("bob") {
+		t.Fatalf("Expected only alice to be registered")
+	}
+	if !store.Verify("ALICE", "hunter22") || store.Verify("alice", "hunter23") || store.Verify("bob", "hunter22") {
+		t.Fatalf("Expected only alice's own password to verify")
+	}
+}
+
+func TestReservedName(t *testing.T) {
+	s := NewTestServer(t)
+	keeper := s.Join(s.Room(), "keeper")
+	keeper.Run([]Step{
+		{Send: "/register hunter22", Expect: []string{"account -- | keeper is yours now"}},
+		{Send: "/register hunter22", Expect: []string{"err -- | You are already logged in as keeper"}},
+	})
+
+	// Someone else can't take the name in another room
+	room := s.Room()
+	impostor := s.Connect()
+	impostor.Expect(Tr(ROOM_MSG))
+	impostor.Send(room)
+	impostor.Expect(Tr(NICK_MSG))
+	impostor.Send("Keeper")
+	impostor.Expect(Tr(PASSWORD_MSG, "Keeper"))
+	impostor.Send("letmein")
+	impostor.Expect("Wrong password")
+	impostor.Expect(Tr(NICK_MSG))
+	impostor.Send("keeper")
+	impostor.Expect(Tr(PASSWORD_MSG, "keeper"))
+	impostor.Send("hunter22")
+	impostor.Expect("keeper has joined " + room)
+}
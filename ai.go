@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Codenames for the agents the server plays itself
+var AI_NAMES = []string{"Cipher", "Echo", "Falcon", "Raven", "Bishop"}
+
+// How long a lobby waits for players before the server fills it with AI
+// agents, 0 never does. Set with -ai-fill.
+var LobbyFillWait time.Duration = 0
+
+var (
+	aiChatRe     = regexp.MustCompile(`^(\w+) \| (.*)$`)
+	aiReceivedRe = regexp.MustCompile(`^send -- \| Received file: (\S+)$`)
+	aiWarningRe  = regexp.MustCompile(`^\* -- \| \d+ seconds remaining!$`)
+)
+
+// An AI is a teammate played by the server. Its client reads commands from
+// one end of an in-memory pipe and the AI plays the other end like any
+// player would, following the solver's plan for the team. It only knows the
+// team from the views its game hands it.
+type AI struct {
+	Client *Client
+	conn   net.Conn
+	cmds   chan string
+	wake   chan bool
+	// Files already given a command, until they come back
+	pending map[string]bool
+	// Files passed on to a teammate, never passed on twice so two AIs can't
+	// bounce one between them
+	passed map[string]bool
+	asked  map[string]bool
+	hurry  bool
+	// Set once the AI told Glenda it's done, its client only finds out when
+	// the command goes through
+	done bool
+	// The plan for the team, made from the view with this version
+	plan    Plan
+	planned int
+}
+
+func NewAI(name string) *AI {
+	server, agent := net.Pipe()
+	c := NewClient(server)
+	c.Name = name
+	// The AI reads what the server writes, keep it in the language it parses
+	c.Lang = SOURCE_LANG
+	a := &AI{
+		Client:  c,
+		conn:    agent,
+		cmds:    make(chan string, 2*MAX_FILES),
+		wake:    make(chan bool, 1),
+		pending: make(map[string]bool),
+		passed:  make(map[string]bool),
+		asked:   make(map[string]bool),
+		planned: -1,
+	}
+	c.AI = a
+	return a
+}
+
+// AddAI brings an AI agent into the game, telling everyone with the
+// message under key followed by its name
+func (g *Game) AddAI(key string, args ...interface{}) {
+	name := ""
+	for i := 0; i < len(AI_NAMES) && name == ""; i++ {
+		candidate := AI_NAMES[(g.aiCount+i)%len(AI_NAMES)]
+		if _, ok := g.Clients[candidate]; !ok {
+			name = candidate
+			g.aiCount += i + 1
+		}
+	}
+	if name == "" {
+		return
+	}
+	g.MsgAll(key, append(args, name)...)
+	a := NewAI(name)
+	go a.Run()
+	g.Join(a.Client)
+}
+
+// FillWithAI adds AI agents until the team is full
+func (g *Game) FillWithAI() {
+	if g.Status != LOBBY || len(g.Clients) == 0 {
+		return
+	}
+	for i := len(g.Clients); i < g.TeamSize; i++ {
+		g.AddAI("ai.filled")
+	}
+}
+
+// NudgeAI wakes the game's AI agents to look at the team again
+func (g *Game) NudgeAI() {
+	for _, c := range g.Clients {
+		if c.AI != nil {
+			select {
+			case c.AI.wake <- true:
+			default:
+			}
+		}
+	}
+}
+
+// AddAIs lets the game owner bring in an AI agent, or fill the team with
+// them, from the lobby
+func (c *Client) AddAIs(arg string) {
+	g := c.Game
+	if c.Name != g.Owner {
+		c.Tell("ai.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	n := 1
+	if arg == "fill" {
+		n = g.TeamSize - len(g.Clients)
+	}
+	if len(g.Clients)+n > g.TeamSize || n < 1 {
+		c.Tell("ai.full")
+		return
+	}
+	for i := 0; i < n; i++ {
+		g.AddAI("ai.added", c.Name)
+	}
+}
+
+// Run plays the game until the client ends
+func (a *AI) Run() {
+	defer a.conn.Close()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		bufr := bufio.NewReader(a.conn)
+		for {
+			line, err := bufr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+	go func() {
+		for cmd := range a.cmds {
+			if _, err := a.conn.Write([]byte(cmd + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+	defer close(a.cmds)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			a.Read(line)
+		case <-a.wake:
+		}
+		a.Act()
+	}
+}
+
+// Read takes in one line the server wrote to the AI
+func (a *AI) Read(line string) {
+	if m := aiReceivedRe.FindStringSubmatch(line); m != nil {
+		delete(a.pending, m[1])
+		return
+	}
+	if aiWarningRe.MatchString(line) {
+		// Stop waiting on teammates, send what we can
+		a.hurry = true
+		return
+	}
+	// Lines from the NPC are skipped by Answer, it isn't a teammate
+	if m := aiChatRe.FindStringSubmatch(line); m != nil {
+		a.Answer(m[1], m[2])
+	}
+}
+
+// Answer replies to a teammate's /msg
+func (a *AI) Answer(from string, text string) {
+	v := a.Client.View()
+	if v == nil || v.Status != RUNNING {
+		return
+	}
+	me, _ := v.Agent(a.Client.Name)
+	teammate, ok := v.Agent(from)
+	if !ok || teammate.AI {
+		// Never answer another AI, they would talk forever
+		return
+	}
+	text = strings.ToLower(text)
+	// Requests are understood in the teammate's language
+	asks := func(key string) bool {
+		for _, word := range strings.Split(teammate.Tr(key), ",") {
+			if word = strings.TrimSpace(word); word != "" && strings.Contains(text, word) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case asks("ai.words.send"):
+		for _, f := range me.Files {
+			if strings.Contains(text, strings.ToLower(f.Filename)) {
+				if a.pending[f.Filename] {
+					a.Say(teammate, "ai.busy", f.Filename)
+					return
+				}
+				a.pending[f.Filename] = true
+				a.passed[f.Filename] = true
+				a.Command(fmt.Sprintf("/send %s %s", from, f.Filename))
+				a.Say(teammate, "ai.sending", f.Filename)
+				return
+			}
+		}
+		a.Say(teammate, "ai.no_file")
+	case asks("ai.words.list"):
+		names := make([]string, 0, len(me.Files))
+		for _, f := range me.Files {
+			names = append(names, teammate.Tr("ai.file", f.Filename, f.Size, f.Secrecy))
+		}
+		if len(names) == 0 {
+			a.Say(teammate, "ai.empty", me.Bandwidth)
+			return
+		}
+		a.Say(teammate, "ai.holding", strings.Join(names, ", "), me.Bandwidth)
+	case asks("ai.words.plan"):
+		mine := make([]string, 0)
+		for _, f := range a.Plan(v)[from] {
+			mine = append(mine, f.Filename)
+		}
+		if len(mine) == 0 {
+			a.Say(teammate, "ai.plan_nothing")
+			return
+		}
+		a.Say(teammate, "ai.plan", strings.Join(mine, ", "))
+	default:
+		a.Say(teammate, "ai.help")
+	}
+}
+
+// Say sends a teammate a message in their language
+func (a *AI) Say(to AgentView, key string, args ...interface{}) {
+	a.Command(fmt.Sprintf("/msg %s %s", to.Name, to.Tr(key, args...)))
+}
+
+// Plan is the solver's plan for the team in v, solved again only when the
+// team has changed since the last one
+func (a *AI) Plan(v *TeamView) Plan {
+	if v.Version != a.planned {
+		a.plan = v.Solution().Plan
+		a.planned = v.Version
+	}
+	return a.plan
+}
+
+// Command queues a line for the AI's client to read, like a player typing it
+func (a *AI) Command(cmd string) {
+	select {
+	case a.cmds <- cmd:
+	default:
+		log.Printf("AI %s dropped command %q", a.Client.Name, cmd)
+	}
+}
+
+// Act follows the solver's plan for the team as it stands: send Glenda
+// what the plan gives us, pass on what it gives others, and tell Glenda
+// we're done once nothing else is coming our way
+func (a *AI) Act() {
+	c := a.Client
+	v := c.View()
+	if v == nil || v.Status != RUNNING || a.done {
+		return
+	}
+	plan := a.Plan(v)
+	me, _ := v.Agent(c.Name)
+
+	held := make(map[string]bool)
+	for _, f := range me.Files {
+		held[f.Filename] = true
+		if a.pending[f.Filename] {
+			continue
+		}
+		owner := plan.Owner(f.Filename)
+		switch {
+		case owner == c.Name:
+			a.pending[f.Filename] = true
+			a.Command(fmt.Sprintf("/send %s %s", v.NPC, f.Filename))
+		case owner != "" && !a.passed[f.Filename]:
+			a.pending[f.Filename] = true
+			a.passed[f.Filename] = true
+			a.Command(fmt.Sprintf("/send %s %s", owner, f.Filename))
+		}
+	}
+
+	waiting := false
+	for _, f := range plan[c.Name] {
+		if held[f.Filename] {
+			continue
+		}
+		waiting = true
+		for _, teammate := range v.Agents {
+			if teammate.AI || a.asked[f.Filename] {
+				continue
+			}
+			for _, theirs := range teammate.Files {
+				if theirs.Filename == f.Filename {
+					a.asked[f.Filename] = true
+					a.Say(teammate, "ai.ask", f.Filename)
+				}
+			}
+		}
+	}
+	if waiting && !a.hurry {
+		return
+	}
+	log.Printf("AI %s is done in game %s", c.Name, v.Game)
+	a.Command(fmt.Sprintf("/msg %s done", v.NPC))
+	a.done = true
+}
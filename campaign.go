@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Mission struct {
+	Name string // Progress is saved under the name, it never changes
+	// Prefix of the mission's messages: its name in every language, the
+	// intro and the line for beating it
+	Key        string
+	TeamSize   int
+	Duration   time.Duration
+	Difficulty int
+	// Percentage of the optimal score needed to unlock the next mission
+	Target int
+}
+
+var CAMPAIGN = []Mission{
+	{
+		Name:       "Orientation",
+		Key:        "mission.orientation",
+		TeamSize:   2,
+		Duration:   90 * time.Second,
+		Difficulty: EASY,
+		Target:     70,
+	},
+	{
+		Name:       "Quarterly Review",
+		Key:        "mission.quarterly_review",
+		TeamSize:   3,
+		Duration:   75 * time.Second,
+		Difficulty: NORMAL,
+		Target:     80,
+	},
+	{
+		Name:       "The Merger",
+		Key:        "mission.merger",
+		TeamSize:   3,
+		Duration:   60 * time.Second,
+		Difficulty: HARD,
+		Target:     85,
+	},
+	{
+		Name:       "Phase Two",
+		Key:        "mission.phase_two",
+		TeamSize:   4,
+		Duration:   60 * time.Second,
+		Difficulty: HARD,
+		Target:     90,
+	},
+}
+
+// CampaignProgress is a team's best percentage of optimal for each mission
+// it has completed
+type CampaignProgress map[string]int
+
+// A CampaignStore with no Path keeps its progress in memory
+type CampaignStore struct {
+	Path  string
+	mu    sync.Mutex
+	teams map[string]CampaignProgress
+}
+
+var Campaigns *CampaignStore = NewCampaignStore(GetCampaignFile())
+
+func GetCampaignFile() string {
+	path := os.Getenv("CAMPAIGN_FILE")
+	if path == "" {
+		path = "campaign.json"
+	}
+	return path
+}
+
+func NewCampaignStore(path string) *CampaignStore {
+	return &CampaignStore{Path: path}
+}
+
+func (s *CampaignStore) load() {
+	if s.teams != nil {
+		return
+	}
+	s.teams = make(map[string]CampaignProgress)
+	if s.Path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading campaign progress: %s", err.Error())
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &s.teams); err != nil {
+		log.Printf("Error parsing campaign progress: %s", err.Error())
+	}
+}
+
+func (s *CampaignStore) Progress(team string) CampaignProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	progress := make(CampaignProgress)
+	for k, v := range s.teams[team] {
+		progress[k] = v
+	}
+	return progress
+}
+
+// Record saves percent for a mission if it beats the team's best
+func (s *CampaignStore) Record(team string, mission string, percent int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	if s.teams[team] == nil {
+		s.teams[team] = make(CampaignProgress)
+	}
+	if best, ok := s.teams[team][mission]; ok && best >= percent {
+		return nil
+	}
+	s.teams[team][mission] = percent
+
+	if s.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.teams, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0644)
+}
+
+// Unlocked reports whether the team may play mission i
+func (p CampaignProgress) Unlocked(i int) bool {
+	if i == 0 {
+		return true
+	}
+	best, ok := p[CAMPAIGN[i-1].Name]
+	return ok && best >= CAMPAIGN[i-1].Target
+}
+
+// Campaign lists the missions, or lets the game owner pick one in the lobby
+func (c *Client) Campaign(arg string) {
+	g := c.Game
+	progress := g.Campaigns.Progress(g.ProgressKey())
+	if arg == "" {
+		text := c.Tr("campaign.progress", g.ProgressOwner())
+		for i, m := range CAMPAIGN {
+			state := T("campaign.locked")
+			if best, ok := progress[m.Name]; ok {
+				state = T("campaign.best", best)
+			} else if progress.Unlocked(i) {
+				state = T("campaign.unlocked")
+			}
+			text += c.Tr("campaign.mission", i+1, m.Title(), m.TeamSize, DIFFICULTIES[m.Difficulty], m.Target, state)
+		}
+		text += c.Tr("campaign.pick")
+		c.MsgCh <- Message{Text: text}
+		return
+	}
+
+	if c.Name != g.Owner {
+		c.Tell("campaign.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	if g.Building != nil {
+		c.Tell("versus.campaign")
+		return
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(CAMPAIGN) {
+		c.Tell("campaign.usage", len(CAMPAIGN))
+		return
+	}
+	if !progress.Unlocked(n - 1) {
+		prev := CAMPAIGN[n-2]
+		c.Tell("campaign.is_locked", n, prev.Target, prev.Title())
+		return
+	}
+	mission := CAMPAIGN[n-1]
+	if len(g.Clients) > mission.TeamSize {
+		c.Tell("campaign.too_many", mission.Title(), mission.TeamSize, len(g.Clients))
+		return
+	}
+
+	g.SetMission(&mission)
+	g.MsgAll("campaign.picked", c.Name, n, mission.Title(), mission.TeamSize)
+	g.CheckFull()
+}
+
+// Progress saved under an account is keyed by its name behind this prefix,
+// room names can't contain it
+const ACCOUNT_KEY_PREFIX string = "@"
+
+// ProgressKey is who the campaign progress belongs to: the owner's account
+// if they logged in, otherwise the room
+func (g *Game) ProgressKey() string {
+	if owner, ok := g.Clients[g.Owner]; ok && owner.Account != "" {
+		return ACCOUNT_KEY_PREFIX + owner.Account
+	}
+	return g.Name
+}
+
+func (g *Game) ProgressOwner() Text {
+	if owner, ok := g.Clients[g.Owner]; ok && owner.Account != "" {
+		return T("campaign.owner_account", owner.Account)
+	}
+	return T("campaign.owner_team", g.Name)
+}
+
+// Title is the mission's name in the reader's language
+func (m Mission) Title() Text {
+	return T(m.Key + ".name")
+}
+
+func (g *Game) SetMission(m *Mission) {
+	g.Mission = m
+	g.TeamSize = m.TeamSize
+	g.SetDifficulty(m.Difficulty)
+	g.Clock.Duration = m.Duration
+}
+
+// RecordMission saves the team's result and tells them how they did
+func (g *Game) RecordMission(percent int) {
+	m := g.Mission
+	keys := map[string]bool{g.ProgressKey(): true}
+	for _, c := range g.Clients {
+		if c.Account != "" {
+			keys[ACCOUNT_KEY_PREFIX+c.Account] = true
+		}
+	}
+	for key := range keys {
+		if err := g.Campaigns.Record(key, m.Name, percent); err != nil {
+			log.Printf("Error saving campaign progress for %s: %s", key, err.Error())
+		}
+	}
+	if percent < m.Target {
+		g.MsgAll("campaign.missed", m.Target, m.Title())
+		return
+	}
+	g.MsgAll(m.Key + ".success")
+	for i := range CAMPAIGN {
+		if CAMPAIGN[i].Name == m.Name && i+1 < len(CAMPAIGN) {
+			g.MsgAll("campaign.next", i+2, CAMPAIGN[i+1].Title())
+		}
+	}
+}
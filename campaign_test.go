@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCampaignStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goph3r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "campaign.json")
+
+	store := NewCampaignStore(path)
+	if !store.Progress("team").Unlocked(0) || store.Progress("team").Unlocked(1) {
+		t.Fatalf("Expected only the first mission unlocked")
+	}
+
+	store.Record("team", CAMPAIGN[0].Name, CAMPAIGN[0].Target-1)
+	if store.Progress("team").Unlocked(1) {
+		t.Fatalf("Expected mission 2 locked below the target")
+	}
+	store.Record("team", CAMPAIGN[0].Name, CAMPAIGN[0].Target)
+	store.Record("team", CAMPAIGN[0].Name, 10)
+
+	// Progress survives a restart and keeps the best result
+	progress := NewCampaignStore(path).Progress("team")
+	if progress[CAMPAIGN[0].Name] != CAMPAIGN[0].Target || !progress.Unlocked(1) {
+		t.Fatalf("Expected mission 2 unlocked after reloading, got %v", progress)
+	}
+	if NewCampaignStore(path).Progress("other").Unlocked(1) {
+		t.Fatalf("Expected progress to be per team")
+	}
+}
+
+func TestCampaignMission(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+
+	alice := s.Join(room, "alice")
+	alice.Run([]Step{
+		{Expect: []string{"alice has joined"}},
+		{Send: "/campaign 2", Expect: []string{"err -- | Mission 2 is locked"}},
+		{Send: "/campaign 1", Expect: []string{"alice picked mission 1: Orientation"}},
+		{Send: "/difficulty hard", Expect: []string{"err -- | Orientation sets its own difficulty"}},
+	})
+
+	bob := s.Join(room, "bob")
+	for _, p := range []*TestPlayer{alice, bob} {
+		p.Expect("mission starting")
+		p.Expect("Mission 1: Orientation")
+	}
+	bob.Run([]Step{
+		{Send: "/status", Expect: []string{"Campaign: Orientation"}},
+	})
+
+	for _, p := range []*TestPlayer{alice, bob} {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range []*TestPlayer{alice, bob} {
+		p.Expect("Game ended. Score 0")
+		p.Expect("You needed 70% of optimal")
+		p.ExpectClosed()
+	}
+	if _, ok := Campaigns.Progress(room)[CAMPAIGN[0].Name]; !ok {
+		t.Errorf("Expected the attempt to be recorded for %s", room)
+	}
+}
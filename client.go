@@ -2,43 +2,63 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"regexp"
 	"strings"
-	"time"
+	"sync"
+	"unicode/utf8"
 )
 
 type Client struct {
 	RWC              io.ReadWriteCloser
 	Name             string
+	Account          string // Name of the account they logged in to, if any
 	ErrCh            chan error
 	MsgCh            chan Message
-	FileCh           chan File
 	InputCh          chan string
 	Files            []File
 	DoneSendingFiles bool
 	Bandwidth        int
+	Budgets          []int    // What is left of the puzzle's other resources
+	Clearances       []string // Departments whose files they may send to Glenda
+	Handoffs         int      // Files they can still pass to teammates
+	Exfiltrated      int      // Secrecy of the files they sent to Glenda
+	Lang             string   // Language they picked, "" for the server's default
+	AI               *AI      // Set when the server plays this agent
 	Game             *Game
 	Done             chan bool
+	flushed          chan bool
+	view             *TeamView // Set by the game for other goroutines
+	viewMu           sync.Mutex
+	unqueued         chan bool // Told when the matchmaking queue lets go of them
+	endOnce          sync.Once
+	readOnce         sync.Once
 }
 
 func NewClient(rwc io.ReadWriteCloser) *Client {
-	return &Client{
+	c := &Client{
 		RWC:     rwc,
 		ErrCh:   make(chan error, 10),
 		MsgCh:   make(chan Message, 10), // TODO do I need a buff chan
-		FileCh:  make(chan File),
 		InputCh: make(chan string),
 		Files:   make([]File, 0),
 		Done:    make(chan bool),
 	}
+	if t, ok := rwc.(*TelnetConn); ok {
+		t.Complete(c.Completions)
+	}
+	return c
 }
 
-func (c *Client) GetName() (string, error) {
+// GetName asks for a nickname, and for the password of names that belong
+// to an account in accounts
+func (c *Client) GetName(accounts *AccountStore) (string, error) {
 	bufw := bufio.NewWriter(c.RWC)
 	re := regexp.MustCompile(`^\w+$`)
+	failures := 0
 	for {
 		name, err := c.Prompt(NICK_MSG)
 		if err != nil {
@@ -47,38 +67,63 @@ func (c *Client) GetName() (string, error) {
 
 		name = re.FindString(name)
 
-		if name == "" || name == "Glenda" {
-			if _, err := bufw.WriteString("Invalid Username\n"); err != nil {
-				log.Printf("Error occuring while writing: %s\n", err.Error())
-				return "", err
+		invalid := "prompt.invalid_name"
+		if name != "" && !IsNPC(name) {
+			if !accounts.Registered(name) {
+				return name, nil
 			}
-			if err := bufw.Flush(); err != nil {
-				log.Printf("Error occured while flushing: %s\n", err.Error())
+			c.Echo(false)
+			password, err := c.Prompt(PASSWORD_MSG, name)
+			c.Echo(true)
+			if err != nil {
 				return "", err
 			}
-			continue
+			if accounts.Verify(name, password) {
+				c.Account = AccountKey(name)
+				return name, nil
+			}
+			log.Printf("Wrong password for account %s", name)
+			if failures++; failures >= MAX_LOGIN_FAILURES {
+				c.WriteString(c.Tr("account.goodbye"))
+				return "", errors.New("too many wrong passwords")
+			}
+			invalid = "account.wrong_password"
+		}
+		if _, err := bufw.WriteString(c.Tr(invalid)); err != nil {
+			log.Printf("Error occuring while writing: %s\n", err.Error())
+			return "", err
+		}
+		if err := bufw.Flush(); err != nil {
+			log.Printf("Error occured while flushing: %s\n", err.Error())
+			return "", err
 		}
-		return name, nil
 	}
 }
 
 func (c *Client) Start() {
+	c.flushed = make(chan bool)
 	go c.ErrHandler()
 	go c.MsgHandler()
-	go c.FileHandler()
 	go c.InputHandler()
 }
 
 func (c *Client) End() {
-	//TODO if client has already left via ctrl-C, this panics
-	//TODO flush channels before closing
-	if c.Game != nil {
-		c.Game.RmCh <- c
-	}
-	time.Sleep(1)
-	close(c.Done)
-	c.RWC.Close()
-	log.Printf("Closed client %s", c.Name)
+	// Both the game and a dropped connection can end a client
+	c.endOnce.Do(func() {
+		if c.Game != nil {
+			select {
+			case c.Game.RmCh <- c:
+			case <-c.Game.Ended:
+			}
+		}
+		close(c.Done)
+		// Let the last messages, like the final score, reach the player
+		if c.flushed != nil {
+			<-c.flushed
+		}
+		c.RWC.Close()
+		log.Printf("Closed client %s", c.Name)
+	})
 }
 
 func (c *Client) ErrHandler() {
@@ -93,93 +138,62 @@ func (c *Client) ErrHandler() {
 	}
 }
 
-func (c *Client) InputHandler() {
-	bufr := bufio.NewReader(c.RWC)
-
-	// Go routine to handle input, non blocking
-	// TODO rewrite to use net.conn timeout feature
-	go func() {
-		for {
-			line, err := bufr.ReadString('\n')
-			if err != nil {
-				c.ErrCh <- err
-				return
+// Read starts reading lines onto InputCh and the error that stops it onto
+// ErrCh, however often it is called
+func (c *Client) Read() {
+	c.readOnce.Do(func() {
+		// Go routine to handle input, non blocking
+		// TODO rewrite to use net.conn timeout feature
+		go func() {
+			bufr := bufio.NewReader(c.RWC)
+			for {
+				line, err := bufr.ReadString('\n')
+				if err != nil {
+					c.ErrCh <- err
+					return
+				}
+				select {
+				case c.InputCh <- line:
+				case <-c.Done:
+					return
+				}
 			}
-			c.InputCh <- line
-		}
-	}()
-
-	for {
-		select {
-		case input := <-c.InputCh:
-			c.ParseInput(input)
-		case <-c.Done:
-			return
-		}
-	}
+		}()
+	})
 }
 
-func (c *Client) ParseInput(input string) {
-	// Toss input if game is in lobby status
-	if c.Game.Status == LOBBY {
-		return
-	}
-
-	re := regexp.MustCompile(`^(\/\w+) *(\S*) *(.*)$`)
-	reResult := re.FindStringSubmatch(input)
-	if reResult == nil {
-		c.MsgCh <- Message{
-			Text: "err -- | Invalid command, try /help to see valid commands\n",
-		}
-		return
-	}
-	command := reResult[1]
-	arg1 := reResult[2]
-	arg2 := reResult[3]
-	switch command {
-	case "/help":
-		c.Help()
-	case "/msg":
-		c.SendMsgTo(arg1, arg2)
-	case "/list":
-		c.ListFiles()
-	case "/send":
-		c.SendFileTo(arg1, arg2)
-	case "/look":
-		c.Look()
-	default:
-		c.MsgCh <- Message{
-			Text: "err -- | Invalid command, try /help to see valid commands\n",
-		}
-	}
-}
+func (c *Client) InputHandler() {
+	// Queued players are already being read
+	c.Read()
 
-func (c *Client) FileHandler() {
-	bufw := bufio.NewWriter(c.RWC)
 	for {
 		select {
-		case f := <-c.FileCh:
-			if _, err := bufw.WriteString(fmt.Sprintf("send -- | Received file: %s\n", f.Filename)); err != nil {
-				c.ErrCh <- err
-				continue
-			}
-			if err := bufw.Flush(); err != nil {
-				c.ErrCh <- err
-				continue
+		case input := <-c.InputCh:
+			// Commands run on the game's goroutine
+			select {
+			case c.Game.InputCh <- Input{Client: c, Text: input}:
+			case <-c.Done:
+				return
 			}
-
-			c.Files = append(c.Files, f)
 		case <-c.Done:
 			return
 		}
 	}
 }
 
+// Receive gives c a file a teammate sent
+func (c *Client) Receive(f File) {
+	c.Files = append(c.Files, f)
+	c.MsgCh <- Message{Text: c.Tr("send.received", f.Filename), Notice: true}
+}
+
 func (c *Client) MsgHandler() {
+	defer close(c.flushed)
 	bufw := bufio.NewWriter(c.RWC)
 	for {
 		select {
 		case msg := <-c.MsgCh:
+			c.Remember(msg)
 			if _, err := bufw.WriteString(msg.Text); err != nil {
 				c.ErrCh <- err
 				continue
@@ -189,40 +203,92 @@ func (c *Client) MsgHandler() {
 				continue
 			}
 		case <-c.Done:
-			return
+			for {
+				select {
+				case msg := <-c.MsgCh:
+					c.Remember(msg)
+					bufw.WriteString(msg.Text)
+				default:
+					bufw.Flush()
+					return
+				}
+			}
 		}
 	}
 }
 
-func (c *Client) Help() {
-	c.MsgCh <- Message{Text: HELP_MSG}
-}
-
 func (c *Client) SendMsgTo(to string, text string) {
-	c.Game.MsgCh <- Message{
+	c.Game.Route(Message{
 		From: c.Name,
 		To:   to,
 		Text: text,
-	}
+	})
 }
 
 func (c *Client) ListFiles() {
 	bufw := bufio.NewWriter(c.RWC)
-	_, err := bufw.WriteString(fmt.Sprintf("list -- | Remaining Bandwidth: %d KB\n", c.Bandwidth))
+	_, err := bufw.WriteString(c.Tr("list.bandwidth", c.Bandwidth))
 	if err != nil {
 		c.ErrCh <- err
 		return
 	}
 
-	_, err = bufw.WriteString(fmt.Sprintf("list -- | %20s  %8s  %13s\n", "Filename", "Size", "Secrecy Value"))
+	resources := c.Game.Resources()
+	for k, r := range resources {
+		if _, err := bufw.WriteString(c.Tr("list.budget", T(r.Name), c.Budgets[k], T(r.Unit))); err != nil {
+			c.ErrCh <- err
+			return
+		}
+	}
+
+	clearance := c.Game.HasClearances()
+	if clearance {
+		if _, err := bufw.WriteString(c.Tr("list.clearance", strings.Join(c.Clearances, ", "))); err != nil {
+			c.ErrCh <- err
+			return
+		}
+	}
+
+	extra := ""
+	for _, r := range resources {
+		extra += fmt.Sprintf("  %12s", c.Tr(r.Name))
+	}
+	if clearance {
+		extra += fmt.Sprintf("  %9s", c.Tr("list.clearance_column"))
+	}
+	// The filename column shrinks to fit narrow terminals
+	filenames := []string{c.Tr("list.filename")}
 	for _, f := range c.Files {
-		_, err = bufw.WriteString(fmt.Sprintf("list -- | %20s  %5d KB  %13d\n", f.Filename, f.Size, f.Secrecy))
+		filenames = append(filenames, f.Filename)
+	}
+	rest := utf8.RuneCountInString(c.Tr("list.header", 0, "", c.Tr("list.size"), c.Tr("list.secrecy")) + extra)
+	width := c.Column(filenames, rest)
+	header := c.Tr("list.header", width, c.Tr("list.filename"), c.Tr("list.size"), c.Tr("list.secrecy"))
+	_, err = bufw.WriteString(header + extra + "\n")
+	for _, f := range c.Files {
+		row := c.Tr("list.row", width, f.Filename, f.Size, f.Secrecy)
+		for k := range resources {
+			row += fmt.Sprintf("  %12d", f.Costs[k])
+		}
+		if clearance {
+			row += fmt.Sprintf("  %9s", f.Clearance)
+		}
+		_, err = bufw.WriteString(row + "\n")
 		if err != nil {
 			c.ErrCh <- err
 			return
 		}
 	}
 
+	if c.Game != nil {
+		for _, con := range c.Game.Puzzle.Constraints {
+			if _, err := bufw.WriteString(c.Tr("list.note", con.Text())); err != nil {
+				c.ErrCh <- err
+				return
+			}
+		}
+	}
+
 	if err := bufw.Flush(); err != nil {
 		c.ErrCh <- err
 		return
@@ -232,9 +298,7 @@ func (c *Client) ListFiles() {
 func (c *Client) SendFileTo(to string, filename string) {
 	// TODO rewrite to instead route file through server
 	if c.DoneSendingFiles {
-		c.MsgCh <- Message{
-			Text: "err -- | I thought you said you were done sending files.\n",
-		}
+		c.Tell("send.done_already")
 		return
 	}
 	foundFile := false
@@ -245,21 +309,43 @@ func (c *Client) SendFileTo(to string, filename string) {
 		if file.Filename == filename {
 			foundFile = true
 			i = j
-			if to == "Glenda" {
+			if to == c.Game.NPC() {
+				if !Cleared(c.Clearances, file) {
+					c.Tell("send.no_clearance", file.Clearance, filename)
+					return
+				}
+				tripped := false
+				if b := c.Game.Building; b != nil {
+					var err error
+					if tripped, err = b.Claim(c.Game, file); err != nil {
+						c.Tell("send.error", err)
+						return
+					}
+				}
 				foundClient = true
 				// Use up bandwidth when sending to Glenda
-				c.Game.FileCh <- file
-				c.Bandwidth -= file.Size
-				if c.Bandwidth < 0 {
+				c.Game.ReceiveFile(file)
+				if over := c.Spend(file); over != "" {
 					// fail the game
-					c.Game.Status = FAIL
+					c.Game.Fail("fail.over_budget", c.Name, T(over))
 					return
 				}
+				if tripped {
+					c.Game.Fail("fail.lockdown", c.Name)
+				}
+				c.Exfiltrated += file.Secrecy
 			}
 			for _, client := range c.Game.Clients {
 				if to == client.Name {
 					foundClient = true
-					client.FileCh <- file
+					if c.Game.Variants[HANDOFF_VARIANT] {
+						if c.Handoffs <= 0 {
+							c.Tell("send.no_handoffs")
+							return
+						}
+						c.Handoffs--
+					}
+					client.Receive(file)
 					break
 				}
 			}
@@ -268,39 +354,48 @@ func (c *Client) SendFileTo(to string, filename string) {
 	}
 
 	if !foundFile {
-		c.MsgCh <- Message{
-			Text: fmt.Sprintf("err -- | Error sending file: file \"%s\" does not exist\n", filename),
-		}
+		c.Tell("send.no_file", filename)
 		return
 	}
 	if !foundClient {
-		c.MsgCh <- Message{
-			Text: fmt.Sprintf("err -- | Error sending file: client \"%s\" does not exist", to),
-		}
+		c.Tell("send.no_client", to)
 		return
 	}
-	c.MsgCh <- Message{
-		Text: fmt.Sprintf("send -- | Sent file: %s\nsend -- | Bandwidth remaining: %s\n", filename, c.Bandwidth),
+	text := c.Tr("send.sent", filename, c.Bandwidth)
+	for k, r := range c.Game.Resources() {
+		text += c.Tr("send.budget", T(r.Name), c.Budgets[k], T(r.Unit))
+	}
+	if to != c.Game.NPC() && c.Game.Variants[HANDOFF_VARIANT] {
+		text += c.Tr("send.handoffs", c.Handoffs)
 	}
+	c.MsgCh <- Message{Text: text}
+
+	c.Files = append(c.Files[:i], c.Files[i+1:]...)
+}
 
-	files := c.Files
-	newFiles := make([]File, 0, len(files)-1)
-	if i == 0 {
-		newFiles = files[1:]
-	} else if i == len(files)-1 {
-		newFiles = files[:len(files)-1]
-	} else {
-		newFiles = append(files[:i-1], files[i:]...)
+// Spend uses up the costs of sending f to Glenda and returns the message key
+// of the first resource that ran out, or "" if everything is still in budget
+func (c *Client) Spend(f File) string {
+	over := ""
+	c.Bandwidth -= f.Size
+	if c.Bandwidth < 0 {
+		over = "resource.bandwidth"
 	}
-	c.Files = newFiles
+	for k, r := range c.Game.Resources() {
+		c.Budgets[k] -= f.Costs[k]
+		if c.Budgets[k] < 0 && over == "" {
+			over = r.Name
+		}
+	}
+	return over
 }
 
 func (c *Client) Look() {
-	lookText := "look -- | You look around at your co-workers' nametags:\n"
+	lookText := c.Tr("look.intro")
 	for _, client := range c.Game.Clients {
-		lookText += ("look -- | " + client.Name + "\n")
+		lookText += c.Tr("look.name", client.Name)
 	}
-	lookText += "look -- | Glenda\n"
+	lookText += c.Tr("look.name", c.Game.NPC())
 	c.MsgCh <- Message{Text: lookText}
 }
 
@@ -330,14 +425,31 @@ func (c *Client) ReadLine() (string, error) {
 	return line, nil
 }
 
-func (c *Client) Prompt(question string) (string, error) {
-	if err := c.WriteString(question); err != nil {
-		return "", err
-	}
+// Prompt asks the question under key until the answer isn't /lang, which
+// switches the player's language before they join a game
+func (c *Client) Prompt(key string, args ...interface{}) (string, error) {
+	for {
+		if err := c.WriteString(c.Tr(key, args...)); err != nil {
+			return "", err
+		}
 
-	ans, err := c.ReadLine()
-	if err != nil {
-		return "", err
+		ans, err := c.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		m := langCommandRe.FindStringSubmatch(ans)
+		if m == nil {
+			return ans, nil
+		}
+		text := c.LanguagesText()
+		if m[1] != "" {
+			text = c.Tr("lang.unknown", m[1], strings.Join(Langs(), ", "))
+			if c.PickLanguage(m[1]) {
+				text = c.Tr("lang.set", c.Catalog().Name)
+			}
+		}
+		if err := c.WriteString(text); err != nil {
+			return "", err
+		}
 	}
-	return ans, nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -20,60 +21,45 @@ func NewCloseableBuffer() *CloseableBuffer {
 
 func TestNewClient(t *testing.T) {
 	rwc := NewCloseableBuffer()
-	nickname := "gopher1"
 
-	client := NewClient(rwc, nickname)
-	expectedClient := &Client{
-		RWC:      rwc,
-		Nickname: nickname,
+	client := NewClient(rwc)
+	if client.RWC != rwc {
+		t.Fatalf("Error creating client ReadWriteCloser: expected %v, got %v", rwc, client.RWC)
 	}
-	if client.RWC != expectedClient.RWC {
-		t.Fatalf("Error creating client ReadWriteCloser: expected %v, got %v", client.RWC, expectedClient.RWC)
-	}
-	if client.Nickname != expectedClient.Nickname {
-		t.Fatalf("Error creating client nickname: expected %s, got %s", client.Nickname, expectedClient.Nickname)
+	if len(client.Files) != 0 {
+		t.Fatalf("Expected new client to have no files, got %#v", client.Files)
 	}
 }
 
-func TestInitClient(t *testing.T) {
+func TestGetName(t *testing.T) {
 	rwc := NewCloseableBuffer()
+	client := NewClient(rwc)
 
-	clientch := make(chan *Client)
-	done := make(chan bool)
-	go func() {
-		InitClient(rwc, clientch)
-		done <- true
-	}()
-
-	_, err := rwc.WriteString("gopher1\n")
-	if err != nil {
+	if _, err := rwc.WriteString("gopher1\n"); err != nil {
 		t.Fatalf("An error occured while writing: %s", err.Error())
 	}
 
-	client := <-clientch
-	expectedClient := NewClient(rwc, "gopher1")
-	if client.RWC != expectedClient.RWC {
-		t.Fatalf("Error creating client ReadWriteCloser: expected %v, got %v", client.RWC, expectedClient.RWC)
+	name, err := client.GetName(Accounts)
+	if err != nil {
+		t.Fatalf("Error getting name: %s", err.Error())
 	}
-	if client.Nickname != expectedClient.Nickname {
-		t.Fatalf("Error creating client nickname: expected %s, got %s", client.Nickname, expectedClient.Nickname)
+	if name != "gopher1" {
+		t.Fatalf("Error getting name: expected %s, got %s", "gopher1", name)
 	}
 }
 
-func TestFileHandler(t *testing.T) {
-	rwc := NewCloseableBuffer()
-	client := NewClient(rwc, "gopher1")
-
-	done := make(chan bool)
-
-	go client.FileHandler(done)
+func TestReceive(t *testing.T) {
+	client := NewClient(NewCloseableBuffer())
 
 	file := File{
 		Filename: "testfile.txt",
 		Size:     100,
 		Secrecy:  100,
 	}
-	client.Filechan <- file
+	client.Receive(file)
+	if msg := <-client.MsgCh; !strings.Contains(msg.Text, "Received file: "+file.Filename) || !msg.Notice {
+		t.Fatalf("Expected to be told about %s, got %#v", file.Filename, msg)
+	}
 
 	for _, f := range client.Files {
 		if f.Filename == file.Filename {
@@ -85,7 +71,8 @@ func TestFileHandler(t *testing.T) {
 
 func TestListFiles(t *testing.T) {
 	rwc := NewCloseableBuffer()
-	client := NewClient(rwc, "gopher1")
+	client := NewClient(rwc)
+	client.Bandwidth = 100
 
 	file := File{
 		Filename: "testfile.txt",
@@ -97,30 +84,11 @@ func TestListFiles(t *testing.T) {
 
 	client.ListFiles()
 
-	list := ""
-	line, err := rwc.ReadString('\n')
-	if err != nil {
-		t.Errorf("Error while reading: %s", err.Error())
-	}
-	list += line
-
-	line, err = rwc.ReadString('\n')
-	if err != nil {
-		t.Errorf("Error while reading: %s", err.Error())
-	}
-	list += line
-
-	line, err = rwc.ReadString('\n')
-	if err != nil {
-		t.Errorf("Error while reading: %s", err.Error())
-	}
-	list += line
-
 	expectedList := "list -- | Remaining Bandwidth: 100 KB\n" +
-		"list -- |  Name          Size  Secrecy Value\n" +
-		"list -- |  testfile.txt  100   100\n"
+		"list -- |             Filename      Size  Secrecy Value\n" +
+		"list -- |         testfile.txt    100 KB            100\n"
 
-	if list != expectedList {
+	if list := rwc.String(); list != expectedList {
 		t.Errorf("Expected:\n%s got:\n%s", expectedList, list)
 	}
 }
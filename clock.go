@@ -0,0 +1,170 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	EASY = iota
+	NORMAL
+	HARD
+)
+
+var DIFFICULTIES = []string{"easy", "normal", "hard"}
+
+// Mission length for each difficulty, unless the scenario says otherwise
+var MISSION_DURATIONS = map[int]time.Duration{
+	EASY:   90 * time.Second,
+	NORMAL: 60 * time.Second,
+	HARD:   40 * time.Second,
+}
+
+// Clock is the source of time for a game, tests swap in a fake one
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Remaining times at which the clock warns everyone
+var MISSION_WARNINGS = []time.Duration{30 * time.Second, 10 * time.Second, 5 * time.Second}
+
+// MissionClock counts down a mission from the moment it starts, sending the
+// remaining time on Warning as it passes each threshold and true on Timeout
+// when it runs out.
+type MissionClock struct {
+	Time     Clock
+	Duration time.Duration
+	Warnings []time.Duration
+	Started  time.Time
+	Warning  chan time.Duration
+	Timeout  chan bool
+	stop     chan bool
+}
+
+func NewMissionClock(clock Clock, duration time.Duration, warnings []time.Duration) *MissionClock {
+	sorted := make([]time.Duration, len(warnings))
+	copy(sorted, warnings)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	return &MissionClock{
+		Time:     clock,
+		Duration: duration,
+		Warnings: sorted,
+		Warning:  make(chan time.Duration),
+		Timeout:  make(chan bool),
+		stop:     make(chan bool),
+	}
+}
+
+func (mc *MissionClock) Begin() {
+	mc.Started = mc.Time.Now()
+	go mc.run()
+}
+
+// Stop ends the countdown without a timeout, it must only be called once
+func (mc *MissionClock) Stop() {
+	close(mc.stop)
+}
+
+func (mc *MissionClock) Running() bool {
+	return !mc.Started.IsZero()
+}
+
+// Remaining is the time left on the mission, the full duration if it has
+// not started yet
+func (mc *MissionClock) Remaining() time.Duration {
+	if !mc.Running() {
+		return mc.Duration
+	}
+	left := mc.Duration - mc.Time.Now().Sub(mc.Started)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func (mc *MissionClock) run() {
+	for _, w := range mc.Warnings {
+		if w >= mc.Duration {
+			continue
+		}
+		select {
+		case <-mc.Time.After(mc.Remaining() - w):
+		case <-mc.stop:
+			return
+		}
+		select {
+		case mc.Warning <- w:
+		case <-mc.stop:
+			return
+		}
+	}
+
+	select {
+	case <-mc.Time.After(mc.Remaining()):
+	case <-mc.stop:
+		return
+	}
+	select {
+	case mc.Timeout <- true:
+	case <-mc.stop:
+	}
+}
+
+func ParseDifficulty(name string) (int, error) {
+	for i, d := range DIFFICULTIES {
+		if strings.EqualFold(name, d) {
+			return i, nil
+		}
+	}
+	return 0, T("difficulty.unknown", name)
+}
+
+// Difficulty lets the game owner pick the mission length before it starts
+func (c *Client) Difficulty(name string) {
+	g := c.Game
+	if name == "" {
+		c.Tell("difficulty.show", DIFFICULTIES[g.Difficulty], int(g.Clock.Duration.Seconds()))
+		return
+	}
+	if c.Name != g.Owner {
+		c.Tell("difficulty.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	if g.Mission != nil {
+		c.Tell("difficulty.mission", g.Mission.Title())
+		return
+	}
+	if g.Building != nil {
+		c.Tell("versus.same_rules")
+		return
+	}
+	difficulty, err := ParseDifficulty(name)
+	if err != nil {
+		c.Tell("difficulty.usage", err, strings.Join(DIFFICULTIES, ", "))
+		return
+	}
+	g.SetDifficulty(difficulty)
+	g.MsgAll("difficulty.set", c.Name, DIFFICULTIES[difficulty], int(g.Clock.Duration.Seconds()))
+}
+
+// SetDifficulty must be called before the mission clock starts
+func (g *Game) SetDifficulty(difficulty int) {
+	g.Difficulty = difficulty
+	g.Clock.Duration = g.Scenario.Duration(difficulty)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock only moves forward when Advance is called
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+func TestMissionClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	mc := NewMissionClock(clock, 60*time.Second, []time.Duration{5 * time.Second, 30 * time.Second, 90 * time.Second})
+
+	if mc.Remaining() != 60*time.Second {
+		t.Fatalf("Expected full duration before start, got %s", mc.Remaining())
+	}
+	mc.Begin()
+	clock.Advance(20 * time.Second)
+	if mc.Remaining() != 40*time.Second {
+		t.Fatalf("Expected 40s remaining, got %s", mc.Remaining())
+	}
+
+	// Warnings longer than the mission are skipped
+	clock.Advance(100 * time.Second)
+	for _, expected := range []time.Duration{30 * time.Second, 5 * time.Second} {
+		select {
+		case w := <-mc.Warning:
+			if w != expected {
+				t.Fatalf("Expected warning at %s, got %s", expected, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %s warning", expected)
+		}
+	}
+	select {
+	case <-mc.Timeout:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for timeout")
+	}
+	if mc.Remaining() != 0 {
+		t.Fatalf("Expected no time remaining, got %s", mc.Remaining())
+	}
+}
+
+func TestSeedDeterminesPuzzle(t *testing.T) {
+	deal := func(seed int64) map[string][]File {
+		g := NewGame("seeded", RealClock{}, NewRand(seed))
+		for _, name := range []string{"alice", "bob", "carol"} {
+			c := NewClient(NewCloseableBuffer())
+			c.Name = name
+			g.Clients[name] = c
+		}
+		g.LoadFiles()
+
+		files := make(map[string][]File)
+		for name, c := range g.Clients {
+			files[name] = c.Files
+		}
+		return files
+	}
+
+	if a, b := deal(42), deal(42); !reflect.DeepEqual(a, b) {
+		t.Errorf("Same seed dealt different files:\n%v\n%v", a, b)
+	}
+	if a, b := deal(42), deal(43); reflect.DeepEqual(a, b) {
+		t.Errorf("Different seeds dealt the same files: %v", a)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the /msg a bot sends its teammates to share what it holds
+const INVENTORY_TAG string = "botinv"
+
+var (
+	listBandwidthRe = regexp.MustCompile(`^list -- \| Remaining Bandwidth: (-?\d+) KB$`)
+	listFileRe      = regexp.MustCompile(`^list -- \|\s+(\S+)\s+(\d+) KB\s+(\d+)$`)
+	lookRe          = regexp.MustCompile(`^look -- \| (\w+)$`)
+	receivedRe      = regexp.MustCompile(`^send -- \| Received file: (\S+)$`)
+	chatRe          = regexp.MustCompile(`^(\w+) \| (.*)$`)
+	scoreRe         = regexp.MustCompile(`^Game ended\. Score (-?\d+)`)
+)
+
+// Everything a bot knows about a teammate, itself included
+type Inventory struct {
+	Strategy  string
+	Bandwidth int
+	Files     []File
+}
+
+type Bot struct {
+	Name     string
+	Room     string
+	Strategy Strategy
+	// How long to wait for teammates' inventories before planning without
+	// them, human teammates never send one
+	Wait time.Duration
+
+	conn        net.Conn
+	lines       chan string
+	teammates   []string
+	inventories map[string]Inventory
+	held        map[string]File
+	plan        Plan
+	surveyed    bool
+	shared      bool
+	sentGlenda  bool
+	finished    bool
+	Score       int
+}
+
+func NewBot(name string, room string, strategy Strategy) *Bot {
+	return &Bot{
+		Name:        name,
+		Room:        room,
+		Strategy:    strategy,
+		Wait:        10 * time.Second,
+		lines:       make(chan string, 100),
+		teammates:   make([]string, 0),
+		inventories: make(map[string]Inventory),
+		held:        make(map[string]File),
+	}
+}
+
+// Play connects to the server at addr and plays one game, returning the
+// final score
+func (b *Bot) Play(addr string) (int, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	b.conn = conn
+	defer conn.Close()
+
+	go b.readLines()
+
+	if err := b.answer("collaboration channel", b.Room); err != nil {
+		return 0, err
+	}
+	if err := b.answer("Enter a nickname", b.Name); err != nil {
+		return 0, err
+	}
+	return b.run()
+}
+
+func (b *Bot) readLines() {
+	bufr := bufio.NewReader(b.conn)
+	for {
+		line, err := bufr.ReadString('\n')
+		if line != "" || err == nil {
+			b.lines <- strings.TrimRight(line, "\r\n")
+		}
+		if err != nil {
+			close(b.lines)
+			return
+		}
+	}
+}
+
+// answer waits for a prompt containing question and replies with text
+func (b *Bot) answer(question string, text string) error {
+	for line := range b.lines {
+		if strings.Contains(line, question) {
+			return b.write(text)
+		}
+		if strings.Contains(line, "started without you") {
+			return errors.New("room is full")
+		}
+	}
+	return errors.New("connection closed before prompt")
+}
+
+func (b *Bot) write(text string) error {
+	_, err := fmt.Fprintf(b.conn, "%s\n", text)
+	return err
+}
+
+func (b *Bot) run() (int, error) {
+	var deadline <-chan time.Time
+	for {
+		select {
+		case line, ok := <-b.lines:
+			if !ok {
+				return b.Score, b.result()
+			}
+			if err := b.handle(line); err != nil {
+				return b.Score, err
+			}
+		case <-deadline:
+			deadline = nil
+			b.makePlan()
+		}
+
+		if b.surveyed && !b.shared {
+			b.shared = true
+			b.shareInventory()
+			deadline = time.After(b.Wait)
+		}
+		if b.plan == nil && b.surveyed && len(b.inventories) == len(b.teammates)+1 {
+			deadline = nil
+			b.makePlan()
+		}
+		if b.plan != nil && !b.sentGlenda && b.holdsPlan() {
+			b.sendToGlenda()
+		}
+	}
+}
+
+var errFailed = errors.New("mission failed")
+
+func (b *Bot) result() error {
+	if b.finished {
+		return nil
+	}
+	return errFailed
+}
+
+func (b *Bot) handle(line string) error {
+	log.Printf("%s < %s", b.Name, line)
+	switch {
+	case strings.Contains(line, "Invalid Username"), strings.Contains(line, "name taken"):
+		return fmt.Errorf("nickname %s rejected", b.Name)
+	case strings.Contains(line, "mission starting"):
+		// Message ourselves so we know when /look and /list are answered
+		b.write("/look")
+		b.write("/list")
+		b.write(fmt.Sprintf("/msg %s surveyed", b.Name))
+	case lookRe.MatchString(line):
+		name := lookRe.FindStringSubmatch(line)[1]
+		if name != b.Name && name != "Glenda" {
+			b.teammates = append(b.teammates, name)
+		}
+	case listBandwidthRe.MatchString(line):
+		bandwidth, _ := strconv.Atoi(listBandwidthRe.FindStringSubmatch(line)[1])
+		inv := b.inventories[b.Name]
+		inv.Bandwidth = bandwidth
+		inv.Strategy = b.Strategy.Name()
+		b.inventories[b.Name] = inv
+	case listFileRe.MatchString(line):
+		m := listFileRe.FindStringSubmatch(line)
+		size, _ := strconv.Atoi(m[2])
+		secrecy, _ := strconv.Atoi(m[3])
+		f := File{Filename: m[1], Size: size, Secrecy: secrecy}
+		b.held[f.Filename] = f
+		inv := b.inventories[b.Name]
+		inv.Files = append(inv.Files, f)
+		b.inventories[b.Name] = inv
+	case receivedRe.MatchString(line):
+		// The sender's inventory can arrive after the file itself
+		filename := receivedRe.FindStringSubmatch(line)[1]
+		f, _ := b.lookupFile(filename)
+		f.Filename = filename
+		b.held[filename] = f
+	case scoreRe.MatchString(line):
+		b.Score, _ = strconv.Atoi(scoreRe.FindStringSubmatch(line)[1])
+		b.finished = true
+	case chatRe.MatchString(line):
+		m := chatRe.FindStringSubmatch(line)
+		if m[1] == b.Name && m[2] == "surveyed" {
+			b.surveyed = true
+		} else if strings.HasPrefix(m[2], INVENTORY_TAG+" ") {
+			inv, err := ParseInventory(m[2])
+			if err != nil {
+				log.Printf("%s ignoring inventory from %s: %s", b.Name, m[1], err.Error())
+				break
+			}
+			b.inventories[m[1]] = inv
+		}
+	}
+	return nil
+}
+
+func (b *Bot) lookupFile(filename string) (File, bool) {
+	for _, inv := range b.inventories {
+		for _, f := range inv.Files {
+			if f.Filename == filename {
+				return f, true
+			}
+		}
+	}
+	return File{}, false
+}
+
+func (b *Bot) shareInventory() {
+	text := FormatInventory(b.inventories[b.Name])
+	for _, name := range b.teammates {
+		b.write(fmt.Sprintf("/msg %s %s", name, text))
+	}
+}
+
+// makePlan allocates every known file between the bots that shared their
+// inventory, using the strategy of the bot with the lowest name so the
+// whole team computes the same plan
+func (b *Bot) makePlan() {
+	names := make([]string, 0, len(b.inventories))
+	for name := range b.inventories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]File, 0)
+	agents := make([]Agent, 0)
+	for _, name := range names {
+		inv := b.inventories[name]
+		files = append(files, inv.Files...)
+		agents = append(agents, Agent{Name: name, Capacity: inv.Bandwidth})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+
+	strategy := b.Strategy
+	if s, err := GetStrategy(b.inventories[names[0]].Strategy); err == nil {
+		strategy = s
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(b.Room + ":" + strings.Join(names, ",")))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	b.plan = strategy.Allocate(files, agents, rng)
+	log.Printf("%s planned %d secrecy with %s", b.Name, b.plan.Score(), strategy.Name())
+
+	for _, f := range b.inventories[b.Name].Files {
+		owner := b.plan.Owner(f.Filename)
+		if owner != "" && owner != b.Name {
+			b.write(fmt.Sprintf("/send %s %s", owner, f.Filename))
+			delete(b.held, f.Filename)
+		}
+	}
+}
+
+func (b *Bot) holdsPlan() bool {
+	for _, f := range b.plan[b.Name] {
+		if _, ok := b.held[f.Filename]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bot) sendToGlenda() {
+	b.sentGlenda = true
+	for _, f := range b.plan[b.Name] {
+		b.write(fmt.Sprintf("/send Glenda %s", f.Filename))
+	}
+	b.write("/msg Glenda done")
+}
+
+// FormatInventory encodes inv as "botinv <strategy> <bandwidth> file:size:secrecy..."
+func FormatInventory(inv Inventory) string {
+	parts := []string{INVENTORY_TAG, inv.Strategy, strconv.Itoa(inv.Bandwidth)}
+	for _, f := range inv.Files {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", f.Filename, f.Size, f.Secrecy))
+	}
+	return strings.Join(parts, " ")
+}
+
+func ParseInventory(text string) (Inventory, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || fields[0] != INVENTORY_TAG {
+		return Inventory{}, errors.New("not an inventory")
+	}
+	bandwidth, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return Inventory{}, err
+	}
+	inv := Inventory{Strategy: fields[1], Bandwidth: bandwidth, Files: make([]File, 0)}
+	for _, field := range fields[3:] {
+		i := strings.LastIndex(field, ":")
+		j := strings.LastIndex(field[:max(i, 0)], ":")
+		if i < 0 || j < 0 {
+			return Inventory{}, fmt.Errorf("bad file %q", field)
+		}
+		size, err := strconv.Atoi(field[j+1 : i])
+		if err != nil {
+			return Inventory{}, err
+		}
+		secrecy, err := strconv.Atoi(field[i+1:])
+		if err != nil {
+			return Inventory{}, err
+		}
+		inv.Files = append(inv.Files, File{Filename: field[:j], Size: size, Secrecy: secrecy})
+	}
+	return inv, nil
+}
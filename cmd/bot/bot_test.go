@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestInventoryRoundTrip(t *testing.T) {
+	inv := Inventory{
+		Strategy:  "greedy",
+		Bandwidth: 81,
+		Files: []File{
+			{Filename: "cats.png", Size: 23, Secrecy: 92},
+			{Filename: "notes:draft.md", Size: 31, Secrecy: 57},
+		},
+	}
+	parsed, err := ParseInventory(FormatInventory(inv))
+	if err != nil {
+		t.Fatalf("Error parsing inventory: %s", err.Error())
+	}
+	if !reflect.DeepEqual(inv, parsed) {
+		t.Errorf("Expected %#v, got %#v", inv, parsed)
+	}
+}
+
+func TestStrategiesFitCapacity(t *testing.T) {
+	files := []File{
+		{"a", 23, 92}, {"b", 31, 57}, {"c", 29, 49}, {"d", 44, 68}, {"e", 53, 60},
+		{"f", 38, 43}, {"g", 63, 67}, {"h", 85, 84}, {"i", 89, 86}, {"j", 82, 72},
+	}
+	agents := []Agent{{"x", 50}, {"y", 81}, {"z", 120}}
+
+	for name, s := range STRATEGIES {
+		plan := s.Allocate(files, agents, rand.New(rand.NewSource(1)))
+		for _, a := range agents {
+			size := 0
+			for _, f := range plan[a.Name] {
+				size += f.Size
+			}
+			if size > a.Capacity {
+				t.Errorf("%s: agent %s over capacity, %d > %d", name, a.Name, size, a.Capacity)
+			}
+		}
+	}
+
+	optimal := Optimal{}.Allocate(files, agents, nil).Score()
+	greedy := Greedy{}.Allocate(files, agents, nil).Score()
+	if optimal < greedy {
+		t.Errorf("Optimal scored %d, less than greedy %d", optimal, greedy)
+	}
+}
@@ -0,0 +1,68 @@
+// Command bot plays secret-agent-goph3r over TCP. Bots on the same team
+// share their files and bandwidth with each other over /msg, agree on an
+// allocation and send the chosen files to Glenda.
+//
+//	bot -room demo -bots 3 -strategy optimal
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6000", "server address")
+	room := flag.String("room", "bots", "room to join")
+	name := flag.String("name", "bot", "nickname, numbered when running several bots")
+	strategyName := flag.String("strategy", "optimal", "allocation strategy: greedy, optimal or random")
+	bots := flag.Int("bots", 1, "number of bots to run in this process")
+	wait := flag.Duration("wait", 10*time.Second, "how long to wait for teammates' inventories")
+	verbose := flag.Bool("v", false, "log everything the server says")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	strategy, err := GetStrategy(*strategyName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var wg sync.WaitGroup
+	failed := false
+	var mu sync.Mutex
+	for i := 1; i <= *bots; i++ {
+		nick := *name
+		if *bots > 1 {
+			nick = fmt.Sprintf("%s%d", *name, i)
+		}
+		b := NewBot(nick, *room, strategy)
+		b.Wait = *wait
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			score, err := b.Play(*addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = true
+				fmt.Printf("%s: %s\n", b.Name, err.Error())
+				return
+			}
+			fmt.Printf("%s: score %d\n", b.Name, score)
+		}()
+	}
+	wg.Wait()
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"../../knapsack"
+)
+
+type File struct {
+	Filename string
+	Size     int
+	Secrecy  int
+}
+
+type Agent struct {
+	Name     string
+	Capacity int
+}
+
+// Plan maps each agent name to the files they should send to Glenda
+type Plan map[string][]File
+
+func (p Plan) Owner(filename string) string {
+	for name, files := range p {
+		for _, f := range files {
+			if f.Filename == filename {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func (p Plan) Score() int {
+	score := 0
+	for _, files := range p {
+		for _, f := range files {
+			score += f.Secrecy
+		}
+	}
+	return score
+}
+
+// A Strategy decides which agent sends which file to Glenda. Every bot on a
+// team runs the same strategy on the same input, so Allocate must be
+// deterministic for a given rng.
+type Strategy interface {
+	Name() string
+	Allocate(files []File, agents []Agent, rng *rand.Rand) Plan
+}
+
+var STRATEGIES = map[string]Strategy{
+	"greedy":  Greedy{},
+	"optimal": Optimal{},
+	"random":  Random{},
+}
+
+func GetStrategy(name string) (Strategy, error) {
+	s, ok := STRATEGIES[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy \"%s\"", name)
+	}
+	return s, nil
+}
+
+func newPlan(agents []Agent) Plan {
+	plan := make(Plan)
+	for _, a := range agents {
+		plan[a.Name] = make([]File, 0)
+	}
+	return plan
+}
+
+// Greedy takes files by secrecy per KB and gives each to the agent with the
+// most room left
+type Greedy struct{}
+
+func (Greedy) Name() string { return "greedy" }
+
+func (Greedy) Allocate(files []File, agents []Agent, rng *rand.Rand) Plan {
+	sorted := make([]File, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Secrecy*sorted[j].Size > sorted[j].Secrecy*sorted[i].Size
+	})
+
+	plan := newPlan(agents)
+	room := make([]int, len(agents))
+	for i, a := range agents {
+		room[i] = a.Capacity
+	}
+	for _, f := range sorted {
+		best := -1
+		for i := range agents {
+			if room[i] >= f.Size && (best < 0 || room[i] > room[best]) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			room[best] -= f.Size
+			plan[agents[best].Name] = append(plan[agents[best].Name], f)
+		}
+	}
+	return plan
+}
+
+// Random shuffles the files and agents and takes the first fit
+type Random struct{}
+
+func (Random) Name() string { return "random" }
+
+func (Random) Allocate(files []File, agents []Agent, rng *rand.Rand) Plan {
+	plan := newPlan(agents)
+	room := make(map[string]int)
+	for _, a := range agents {
+		room[a.Name] = a.Capacity
+	}
+	for _, i := range rng.Perm(len(files)) {
+		f := files[i]
+		for _, j := range rng.Perm(len(agents)) {
+			name := agents[j].Name
+			if room[name] >= f.Size {
+				room[name] -= f.Size
+				plan[name] = append(plan[name], f)
+				break
+			}
+		}
+	}
+	return plan
+}
+
+// Optimal searches every assignment with the server's branch and bound
+type Optimal struct{}
+
+func (Optimal) Name() string { return "optimal" }
+
+func (Optimal) Allocate(files []File, agents []Agent, rng *rand.Rand) Plan {
+	items := make([]knapsack.Item, len(files))
+	for i, f := range files {
+		items[i] = knapsack.Item{Name: f.Filename, Size: f.Size, Value: f.Secrecy}
+	}
+	team := make([]knapsack.Agent, len(agents))
+	for i, a := range agents {
+		team[i] = knapsack.Agent{Name: a.Name, Capacity: a.Capacity}
+	}
+
+	plan := newPlan(agents)
+	for i, a := range knapsack.Solve(items, team).Assign {
+		if a >= 0 {
+			name := agents[a].Name
+			plan[name] = append(plan[name], files[i])
+		}
+	}
+	return plan
+}
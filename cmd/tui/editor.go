@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Lines kept for the up and down arrows
+const MAX_HISTORY int = 100
+
+// Editor is the input line at the bottom of the screen
+type Editor struct {
+	Line   []rune
+	Cursor int
+
+	History []string
+	// Where up and down are in History, len(History) is the line being typed
+	browsing int
+	draft    []rune
+}
+
+func NewEditor() *Editor {
+	return &Editor{}
+}
+
+func (e *Editor) Insert(r rune) {
+	e.Line = append(e.Line[:e.Cursor], append([]rune{r}, e.Line[e.Cursor:]...)...)
+	e.Cursor++
+}
+
+func (e *Editor) InsertString(text string) {
+	for _, r := range text {
+		e.Insert(r)
+	}
+}
+
+func (e *Editor) Backspace() {
+	if e.Cursor == 0 {
+		return
+	}
+	e.Line = append(e.Line[:e.Cursor-1], e.Line[e.Cursor:]...)
+	e.Cursor--
+}
+
+func (e *Editor) Delete() {
+	if e.Cursor == len(e.Line) {
+		return
+	}
+	e.Line = append(e.Line[:e.Cursor], e.Line[e.Cursor+1:]...)
+}
+
+func (e *Editor) Left() {
+	if e.Cursor > 0 {
+		e.Cursor--
+	}
+}
+
+func (e *Editor) Right() {
+	if e.Cursor < len(e.Line) {
+		e.Cursor++
+	}
+}
+
+func (e *Editor) Home() {
+	e.Cursor = 0
+}
+
+func (e *Editor) End() {
+	e.Cursor = len(e.Line)
+}
+
+// Kill clears the line, like ctrl-U in a shell
+func (e *Editor) Kill() {
+	e.Line = e.Line[:0]
+	e.Cursor = 0
+}
+
+// Up replaces the line with the one typed before it
+func (e *Editor) Up() {
+	if e.browsing == 0 {
+		return
+	}
+	if e.browsing == len(e.History) {
+		e.draft = append([]rune(nil), e.Line...)
+	}
+	e.browsing--
+	e.set([]rune(e.History[e.browsing]))
+}
+
+// Down goes back towards the line being typed
+func (e *Editor) Down() {
+	if e.browsing == len(e.History) {
+		return
+	}
+	e.browsing++
+	if e.browsing == len(e.History) {
+		e.set(e.draft)
+	} else {
+		e.set([]rune(e.History[e.browsing]))
+	}
+}
+
+func (e *Editor) set(line []rune) {
+	e.Line = append(e.Line[:0], line...)
+	e.Cursor = len(e.Line)
+}
+
+// Submit empties the line and returns it, remembering it for Up
+func (e *Editor) Submit() string {
+	line := string(e.Line)
+	if strings.TrimSpace(line) != "" && (len(e.History) == 0 || e.History[len(e.History)-1] != line) {
+		e.History = append(e.History, line)
+		if len(e.History) > MAX_HISTORY {
+			e.History = e.History[1:]
+		}
+	}
+	e.browsing = len(e.History)
+	e.draft = nil
+	e.Kill()
+	return line
+}
+
+// Complete finishes the word before the cursor from the candidates s has
+// for it. It returns the candidates to show when there is more than one
+func (e *Editor) Complete(s *State) []string {
+	before := string(e.Line[:e.Cursor])
+	words := strings.Split(before, " ")
+	word := words[len(words)-1]
+
+	matches := make([]string, 0)
+	for _, c := range s.Candidates(words) {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	switch len(matches) {
+	case 0:
+		return nil
+	case 1:
+		e.InsertString(strings.TrimPrefix(matches[0], word) + " ")
+		return nil
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) {
+		e.InsertString(prefix[len(word):])
+		return nil
+	}
+	return matches
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"unicode/utf8"
+)
+
+const (
+	KEY_RUNE = iota
+	KEY_ENTER
+	KEY_BACKSPACE
+	KEY_DELETE
+	KEY_TAB
+	KEY_UP
+	KEY_DOWN
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_HOME
+	KEY_END
+	KEY_PGUP
+	KEY_PGDN
+	KEY_CTRL_A
+	KEY_CTRL_C
+	KEY_CTRL_D
+	KEY_CTRL_E
+	KEY_CTRL_L
+	KEY_CTRL_U
+)
+
+type Key struct {
+	Code int
+	Rune rune // For KEY_RUNE
+}
+
+// Escape sequences terminals send for the keys the editor knows
+var ESCAPES = map[string]int{
+	"\x1b[A": KEY_UP, "\x1b[B": KEY_DOWN, "\x1b[C": KEY_RIGHT, "\x1b[D": KEY_LEFT,
+	"\x1bOA": KEY_UP, "\x1bOB": KEY_DOWN, "\x1bOC": KEY_RIGHT, "\x1bOD": KEY_LEFT,
+	"\x1b[H": KEY_HOME, "\x1b[F": KEY_END, "\x1bOH": KEY_HOME, "\x1bOF": KEY_END,
+	"\x1b[1~": KEY_HOME, "\x1b[4~": KEY_END, "\x1b[7~": KEY_HOME, "\x1b[8~": KEY_END,
+	"\x1b[3~": KEY_DELETE, "\x1b[5~": KEY_PGUP, "\x1b[6~": KEY_PGDN,
+}
+
+var CONTROLS = map[byte]int{
+	'\r': KEY_ENTER, '\n': KEY_ENTER, '\t': KEY_TAB, 0x7f: KEY_BACKSPACE, 0x08: KEY_BACKSPACE,
+	0x01: KEY_CTRL_A, 0x03: KEY_CTRL_C, 0x04: KEY_CTRL_D, 0x05: KEY_CTRL_E, 0x0c: KEY_CTRL_L, 0x15: KEY_CTRL_U,
+}
+
+// DecodeKeys turns the bytes read from the terminal into keys. What is left
+// over is the start of a sequence that hasn't fully arrived yet
+func DecodeKeys(buf []byte) ([]Key, []byte) {
+	keys := make([]Key, 0, len(buf))
+	for len(buf) > 0 {
+		b := buf[0]
+		switch {
+		case b == 0x1b:
+			end := escapeEnd(buf)
+			if end < 0 {
+				return keys, buf
+			}
+			if code, ok := ESCAPES[string(buf[:end])]; ok {
+				keys = append(keys, Key{Code: code})
+			}
+			buf = buf[end:]
+		case b < 0x20 || b == 0x7f:
+			if code, ok := CONTROLS[b]; ok {
+				keys = append(keys, Key{Code: code})
+			}
+			// A \r\n from a paste is one enter
+			if b == '\r' && len(buf) > 1 && buf[1] == '\n' {
+				buf = buf[1:]
+			}
+			buf = buf[1:]
+		default:
+			if !utf8.FullRune(buf) {
+				return keys, buf
+			}
+			r, size := utf8.DecodeRune(buf)
+			if r != utf8.RuneError {
+				keys = append(keys, Key{Code: KEY_RUNE, Rune: r})
+			}
+			buf = buf[size:]
+		}
+	}
+	return keys, buf
+}
+
+// escapeEnd is the length of the escape sequence at the start of buf, -1 if
+// it is cut off
+func escapeEnd(buf []byte) int {
+	if len(buf) < 2 {
+		return -1
+	}
+	switch buf[1] {
+	case '[':
+		for i := 2; i < len(buf); i++ {
+			if buf[i] >= 0x40 && buf[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return -1
+	case 'O':
+		if len(buf) < 3 {
+			return -1
+		}
+		return 3
+	}
+	// Alt and a key, or a lone escape followed by something else
+	return 1
+}
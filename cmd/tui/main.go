@@ -0,0 +1,47 @@
+// Command tui is a full-screen terminal client for secret-agent-goph3r. It
+// keeps the chat, your files and bandwidth, the team and the mission timer
+// on screen, and edits what you type with history and tab completion. It
+// speaks the same TCP protocol as nc, and needs a terminal with stty.
+//
+//	tui -addr localhost:6000 -room demo -name alice
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6000", "server address")
+	room := flag.String("room", "", "room to join, typed at the prompt if empty")
+	name := flag.String("name", "", "nickname, typed at the prompt if empty")
+	flag.Parse()
+
+	conn, err := net.Dial("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	term, err := OpenTerminal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error setting up the terminal: %s\n", err.Error())
+		os.Exit(1)
+	}
+	ui := NewUI(conn, term)
+	if *room != "" {
+		ui.State.Answers = append(ui.State.Answers, *room)
+		if *name != "" {
+			ui.State.Answers = append(ui.State.Answers, *name)
+		}
+	}
+	err = ui.Run()
+	term.Restore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Width of the pane with the files and the team, left out on narrow terminals
+const SIDE_WIDTH int = 34
+const MIN_SIDE_TERMINAL int = 60
+
+const (
+	RESET   = "\x1b[0m"
+	BOLD    = "\x1b[1m"
+	DIM     = "\x1b[2m"
+	REVERSE = "\x1b[7m"
+	RED     = "\x1b[31m"
+	GREEN   = "\x1b[32m"
+	YELLOW  = "\x1b[33m"
+	BLUE    = "\x1b[34m"
+	MAGENTA = "\x1b[35m"
+	CYAN    = "\x1b[36m"
+)
+
+// Colours of the chat lines, by how they start
+var CATEGORY_COLOURS = []struct {
+	Prefix string
+	Colour string
+}{
+	{"err -- |", RED},
+	{"fail |", RED + BOLD},
+	{"send -- |", GREEN},
+	{"* -- |", YELLOW},
+	{"--> |", CYAN},
+	{"hint -- |", MAGENTA},
+	{"versus -- |", MAGENTA},
+	{"tui -- |", DIM},
+}
+
+// Render draws the whole screen for a w by h terminal. scroll is clamped to
+// what the chat can scroll back
+func Render(s *State, e *Editor, scroll *int, w, h int, now time.Time) string {
+	if w < 10 || h < 3 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(HIDE_CURSOR)
+	row := func(n int, text string) {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", n, text)
+	}
+
+	row(1, REVERSE+Fit(Header(s, now), w)+RESET)
+
+	chatWidth := w
+	var side []string
+	if w >= MIN_SIDE_TERMINAL {
+		chatWidth = w - SIDE_WIDTH - 1
+		side = SidePane(s, now)
+	}
+	height := h - 2
+	// Rows of the chat, with the line they came from for the colour
+	type chatRow struct{ line, text string }
+	chat := make([]chatRow, 0, len(s.Lines))
+	for _, line := range s.Lines {
+		for _, text := range Wrap(line, chatWidth) {
+			chat = append(chat, chatRow{line, text})
+		}
+	}
+	if max := len(chat) - height; *scroll > max {
+		*scroll = max
+	}
+	if *scroll < 0 {
+		*scroll = 0
+	}
+	end := len(chat) - *scroll
+	start := end - height
+	if start < 0 {
+		start = 0
+	}
+	chat = chat[start:end]
+
+	for i := 0; i < height; i++ {
+		text := ""
+		if i < len(chat) {
+			text = Colour(chat[i].line, Fit(chat[i].text, chatWidth))
+		} else {
+			text = strings.Repeat(" ", chatWidth)
+		}
+		if side != nil {
+			text += DIM + "│" + RESET
+			if i < len(side) {
+				text += side[i]
+			}
+		}
+		row(i+2, text)
+	}
+
+	prompt := "> "
+	room := w - len(prompt) - 1
+	first := 0
+	if e.Cursor > room {
+		first = e.Cursor - room
+	}
+	last := first + room
+	if last > len(e.Line) {
+		last = len(e.Line)
+	}
+	row(h, BOLD+prompt+RESET+string(e.Line[first:last]))
+	fmt.Fprintf(&b, "\x1b[%d;%dH%s", h, len(prompt)+e.Cursor-first+1, SHOW_CURSOR)
+	return b.String()
+}
+
+func Header(s *State, now time.Time) string {
+	text := " secret-agent-goph3r"
+	if s.Room != "" {
+		text += "  room " + s.Room
+	}
+	if s.Name != "" {
+		text += "  agent " + s.Name
+	}
+	switch {
+	case s.Running:
+		left := s.TimeLeft(now)
+		text += fmt.Sprintf("  %d:%02d left", int(left.Minutes()), int(left.Seconds())%60)
+	case s.Ended:
+		text += fmt.Sprintf("  score %d", s.Score)
+	}
+	return text
+}
+
+// SidePane is the rows right of the chat, each SIDE_WIDTH columns wide
+func SidePane(s *State, now time.Time) []string {
+	rows := make([]string, 0)
+	add := func(colour, text string) {
+		if colour == "" {
+			rows = append(rows, Fit(text, SIDE_WIDTH))
+		} else {
+			rows = append(rows, colour+Fit(text, SIDE_WIDTH)+RESET)
+		}
+	}
+
+	if !s.Running && !s.Ended {
+		add(DIM, " Waiting for the mission")
+		return rows
+	}
+	left := s.TimeLeft(now)
+	timer := ""
+	if left < 20*time.Second && s.Running {
+		timer = RED + BOLD
+	}
+	add(timer, fmt.Sprintf(" Time left  %d:%02d", int(left.Minutes()), int(left.Seconds())%60))
+	if s.Bandwidth >= 0 {
+		add("", fmt.Sprintf(" Bandwidth  %d/%d KB", s.Bandwidth, s.Capacity))
+		add(CYAN, " "+Bar(s.Bandwidth, s.Capacity, SIDE_WIDTH-2))
+	}
+
+	add(BOLD, "")
+	add(BOLD, " Files")
+	biggest := 1
+	for _, f := range s.Files {
+		if f.Size > biggest {
+			biggest = f.Size
+		}
+	}
+	for _, f := range s.Files {
+		colour := GREEN
+		if f.Size > s.Bandwidth {
+			colour = RED
+		}
+		add(colour, fmt.Sprintf(" %-15.15s %4d %s", f.Filename, f.Size, Bar(f.Size, biggest, SIDE_WIDTH-22)))
+	}
+
+	add("", "")
+	add(BOLD, " Team")
+	for _, t := range s.Team {
+		if t.Name == s.NPC {
+			continue
+		}
+		name := t.Name
+		if name == s.Name {
+			name += " (you)"
+		}
+		bandwidth := "?"
+		if t.Bandwidth >= 0 {
+			bandwidth = fmt.Sprintf("%d KB", t.Bandwidth)
+		}
+		add("", fmt.Sprintf(" %-20.20s %11s", name, bandwidth))
+	}
+	if s.NPC != "" {
+		add("", "")
+		add(YELLOW, " Contact  "+s.NPC)
+	}
+	return rows
+}
+
+// Bar is a width wide gauge of n out of total
+func Bar(n, total, width int) string {
+	if total <= 0 || n < 0 {
+		n, total = 0, 1
+	}
+	full := n * width / total
+	if full > width {
+		full = width
+	}
+	return strings.Repeat("█", full) + strings.Repeat("░", width-full)
+}
+
+// Colour wraps text, a piece of line, in the colour of line's category
+func Colour(line, text string) string {
+	for _, c := range CATEGORY_COLOURS {
+		if strings.HasPrefix(line, c.Prefix) {
+			return c.Colour + text + RESET
+		}
+	}
+	if m := chatRe.FindStringSubmatch(line); m != nil && strings.HasPrefix(text, m[1]+" |") {
+		return BOLD + BLUE + m[1] + RESET + text[len(m[1]):]
+	}
+	return text
+}
+
+// Wrap breaks line into rows of at most width runes
+func Wrap(line string, width int) []string {
+	runes := []rune(line)
+	rows := make([]string, 0, len(runes)/width+1)
+	for len(runes) > width {
+		rows = append(rows, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(rows, string(runes))
+}
+
+// Fit pads or cuts text to exactly width runes
+func Fit(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag of the /msg the client sends itself after a query, the echo marks the
+// end of the answer
+const QUERY_TAG string = "~tui"
+
+// Lines kept for the chat pane
+const MAX_LINES int = 1000
+
+var (
+	listBandwidthRe = regexp.MustCompile(`^list -- \| .*: (-?\d+) KB$`)
+	listFileRe      = regexp.MustCompile(`^list -- \|\s+(\S+)\s+(\d+) KB\s+(\d+)`)
+	lookNameRe      = regexp.MustCompile(`^look -- \| (\w+)$`)
+	statusRowRe     = regexp.MustCompile(`^status -- \|\s+(\w+)\s+(-?\d+) KB`)
+	statusTimeRe    = regexp.MustCompile(`^status -- \| [^:]+: (\d+)s `)
+	clockRe         = regexp.MustCompile(`^\* -- \| \D*(\d+) \D*$`)
+	startRe         = regexp.MustCompile(`^\* -- \| .*/help`)
+	joinedRe        = regexp.MustCompile(`^--> \| (\w+) [^,]* (\S+),`)
+	helpRowRe       = regexp.MustCompile(`^help -- \| {4}(/\w+)`)
+	scoreRe         = regexp.MustCompile(`^[^|:]+\. \S+ (-?\d+)( \(|$)`)
+	chatRe          = regexp.MustCompile(`^(\w+) \| (.*)$`)
+)
+
+type FileInfo struct {
+	Filename string
+	Size     int
+	Secrecy  int
+}
+
+type Teammate struct {
+	Name      string
+	Bandwidth int // -1 until /status shows it
+}
+
+// State is what the client knows about the game, read from the lines the
+// server sends
+type State struct {
+	Name  string
+	Room  string
+	Lines []string // The chat pane
+
+	Files     []FileInfo
+	Bandwidth int
+	Capacity  int // Bandwidth at the start of the mission
+	Team      []Teammate
+	NPC       string   // Listed last by /look
+	Commands  []string // Read from the /help sent on joining, for completion
+	Deadline  time.Time
+	Running   bool
+	Ended     bool
+	Score     int
+
+	// Replies to the first prompts, from the command line
+	Answers []string
+	// Lines typed before joining, one of them is the nickname
+	typed []string
+	// Queries waiting for their echo, by the prefix of their answer
+	hiding map[string]int
+	// Reading the /help sent on joining, it ends at the first other line
+	learning bool
+}
+
+func NewState() *State {
+	return &State{Bandwidth: -1, hiding: make(map[string]int)}
+}
+
+// Read takes in a line from the server and returns the lines to send back
+func (s *State) Read(line string, now time.Time) []string {
+	if m := chatRe.FindStringSubmatch(line); m != nil && m[1] == s.Name && strings.HasPrefix(m[2], QUERY_TAG+" ") {
+		prefix := QueryPrefix(strings.TrimPrefix(m[2], QUERY_TAG+" "))
+		if s.hiding[prefix] > 0 {
+			s.hiding[prefix]--
+		}
+		return nil
+	}
+
+	if m := helpRowRe.FindStringSubmatch(line); m != nil {
+		s.Learn(m[1])
+	}
+	help := strings.HasPrefix(line, QueryPrefix("/help"))
+	if s.learning && !help && len(s.Commands) > 0 {
+		s.learning = false
+	}
+
+	replies := make([]string, 0)
+	show := !(s.learning && help)
+	for prefix, n := range s.hiding {
+		if n > 0 && strings.HasPrefix(line, prefix) {
+			show = false
+		}
+	}
+	if show {
+		s.Log(line)
+	}
+
+	switch {
+	case !s.Running && !s.Ended && strings.HasSuffix(line, ":") && len(s.Answers) > 0:
+		// A prompt, answer it from the command line
+		replies = append(replies, s.Answers[0])
+		s.Type(s.Answers[0])
+		s.Answers = s.Answers[1:]
+	case joinedRe.MatchString(line) && s.Name == "":
+		m := joinedRe.FindStringSubmatch(line)
+		for _, typed := range s.typed {
+			if typed == m[1] {
+				s.Name, s.Room = m[1], m[2]
+			}
+		}
+		if s.Name != "" {
+			// The commands to complete come from the server's own list
+			replies = append(replies, "/help")
+			s.learning = true
+		}
+	case startRe.MatchString(line):
+		// Campaigns start a mission after another
+		s.Running, s.Ended, s.Capacity = true, false, 0
+		replies = append(replies, s.Query("/look")...)
+		replies = append(replies, s.Query("/list")...)
+		replies = append(replies, s.Query("/status")...)
+	case clockRe.MatchString(line):
+		seconds, _ := strconv.Atoi(clockRe.FindStringSubmatch(line)[1])
+		s.Deadline = now.Add(time.Duration(seconds) * time.Second)
+	case statusTimeRe.MatchString(line):
+		seconds, _ := strconv.Atoi(statusTimeRe.FindStringSubmatch(line)[1])
+		s.Deadline = now.Add(time.Duration(seconds) * time.Second)
+	case listBandwidthRe.MatchString(line):
+		s.Bandwidth, _ = strconv.Atoi(listBandwidthRe.FindStringSubmatch(line)[1])
+		if s.Capacity == 0 {
+			s.Capacity = s.Bandwidth
+		}
+		s.Files = s.Files[:0]
+	case listFileRe.MatchString(line):
+		m := listFileRe.FindStringSubmatch(line)
+		size, _ := strconv.Atoi(m[2])
+		secrecy, _ := strconv.Atoi(m[3])
+		s.Files = append(s.Files, FileInfo{Filename: m[1], Size: size, Secrecy: secrecy})
+	case lookNameRe.MatchString(line):
+		name := lookNameRe.FindStringSubmatch(line)[1]
+		s.Team = append(s.Team, Teammate{Name: name, Bandwidth: -1})
+	case strings.HasPrefix(line, "look -- |"):
+		// The heading of /look, the names follow
+		s.Team = s.Team[:0]
+	case statusRowRe.MatchString(line):
+		m := statusRowRe.FindStringSubmatch(line)
+		bandwidth, _ := strconv.Atoi(m[2])
+		for i := range s.Team {
+			if s.Team[i].Name == m[1] {
+				s.Team[i].Bandwidth = bandwidth
+			}
+		}
+	case strings.HasPrefix(line, "send -- |"), strings.HasPrefix(line, "versus -- |"):
+		// Files came or went, or a rival took one
+		if s.Running && s.hiding["list -- |"] == 0 {
+			replies = append(replies, s.Query("/list")...)
+		}
+	case scoreRe.MatchString(line):
+		s.Score, _ = strconv.Atoi(scoreRe.FindStringSubmatch(line)[1])
+		s.Running = false
+		s.Ended = true
+	case strings.HasPrefix(line, "fail |"):
+		s.Running = false
+		s.Ended = true
+	}
+
+	if n := len(s.Team); n > 0 && strings.HasPrefix(line, "look -- |") {
+		s.NPC = s.Team[n-1].Name
+	}
+	return replies
+}
+
+// Query asks the server for cmd, its answer updates the panes without
+// showing up in the chat
+func (s *State) Query(cmd string) []string {
+	if s.Name == "" {
+		return nil
+	}
+	s.hiding[QueryPrefix(cmd)]++
+	return []string{cmd, fmt.Sprintf("/msg %s %s %s", s.Name, QUERY_TAG, cmd)}
+}
+
+// QueryPrefix is how the lines answering cmd start
+func QueryPrefix(cmd string) string {
+	return strings.TrimPrefix(cmd, "/") + " -- |"
+}
+
+// Learn adds a command /help listed to the ones completed
+func (s *State) Learn(cmd string) {
+	i := sort.SearchStrings(s.Commands, cmd)
+	if i < len(s.Commands) && s.Commands[i] == cmd {
+		return
+	}
+	s.Commands = append(s.Commands, "")
+	copy(s.Commands[i+1:], s.Commands[i:])
+	s.Commands[i] = cmd
+}
+
+// Type records a line the player sent
+func (s *State) Type(line string) {
+	if s.Name == "" {
+		s.typed = append(s.typed, line)
+	}
+}
+
+// Log adds a line to the chat pane
+func (s *State) Log(line string) {
+	s.Lines = append(s.Lines, line)
+	if len(s.Lines) > MAX_LINES {
+		s.Lines = s.Lines[len(s.Lines)-MAX_LINES:]
+	}
+}
+
+// TimeLeft is what is left of the mission, 0 before it starts
+func (s *State) TimeLeft(now time.Time) time.Duration {
+	if s.Deadline.IsZero() || !s.Running {
+		return 0
+	}
+	if left := s.Deadline.Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Candidates completes the last of words: command names first, then agent
+// names and filenames depending on the command
+func (s *State) Candidates(words []string) []string {
+	if len(words) == 1 {
+		return s.Commands
+	}
+	names := make([]string, 0, len(s.Team))
+	for _, t := range s.Team {
+		if t.Name != s.Name {
+			names = append(names, t.Name)
+		}
+	}
+	files := make([]string, 0, len(s.Files))
+	for _, f := range s.Files {
+		files = append(files, f.Filename)
+	}
+	switch {
+	case words[0] == "/send" && len(words) == 2, words[0] == "/msg" && len(words) == 2,
+		words[0] == "/stats" && len(words) == 2:
+		return names
+	case words[0] == "/send" && len(words) == 3:
+		return files
+	case words[0] == "/msg" && len(words) > 2 && words[1] == s.NPC:
+		return []string{"done"}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	ALT_SCREEN_ON  = "\x1b[?1049h"
+	ALT_SCREEN_OFF = "\x1b[?1049l"
+	HIDE_CURSOR    = "\x1b[?25l"
+	SHOW_CURSOR    = "\x1b[?25h"
+)
+
+// Terminal puts the terminal in raw mode on the alternate screen, and
+// reports when it is resized
+type Terminal struct {
+	Resize chan os.Signal
+	saved  string
+}
+
+func OpenTerminal() (*Terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	t := &Terminal{Resize: make(chan os.Signal, 1), saved: saved}
+	signal.Notify(t.Resize, syscall.SIGWINCH)
+	os.Stdout.WriteString(ALT_SCREEN_ON)
+	return t, nil
+}
+
+// Size returns the width and height of the terminal, 80x24 if stty can't
+// tell
+func (t *Terminal) Size() (int, int) {
+	out, err := stty("size")
+	if err != nil {
+		return 80, 24
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 80, 24
+	}
+	rows, err1 := strconv.Atoi(fields[0])
+	cols, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || rows < 1 || cols < 1 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+func (t *Terminal) Write(text string) {
+	os.Stdout.WriteString(text)
+}
+
+// Restore leaves the terminal the way it was found
+func (t *Terminal) Restore() {
+	signal.Stop(t.Resize)
+	os.Stdout.WriteString(SHOW_CURSOR + ALT_SCREEN_OFF)
+	stty(t.saved)
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestStateReadsGame(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewState()
+	s.Answers = []string{"demo", "alice"}
+	lines := []struct {
+		Line    string
+		Replies []string
+	}{
+		{"Log in to your team's assigned collaboration channel, or type quick to be matched with a team:", []string{"demo"}},
+		{"Enter a nickname:", []string{"alice"}},
+		{"--> | alice has joined demo, waiting for teammates...", []string{"/help"}},
+		{"help -- |  Usage:", nil},
+		{"help -- |     /[cmd] [arguments]", nil},
+		{"help -- |    /send [to] [filename]  Send one of your files to", nil},
+		{"help -- |                           a teammate or Glenda", nil},
+		{"help -- |    /look                  See who's here", nil},
+		{"help -- |    /help [command]        Shows this, or explains one", nil},
+		{"help -- |                           /command", nil},
+		{"help -- |  /help [command] explains one command", nil},
+		{"--> | bob has joined demo, waiting for teammates...", nil},
+		{"* -- | Everyone has arrived, mission starting...", nil},
+		{"* -- | Ask for /help to get familiar around here", []string{
+			"/look", "/msg alice ~tui /look", "/list", "/msg alice ~tui /list", "/status", "/msg alice ~tui /status"}},
+		{"* -- | You have 90 seconds before security makes their rounds", nil},
+		{"look -- | You look around at your co-workers' nametags:", nil},
+		{"look -- | alice", nil},
+		{"look -- | bob", nil},
+		{"look -- | Glenda", nil},
+		{"alice | ~tui /look", nil},
+		{"list -- | Remaining Bandwidth: 120 KB", nil},
+		{"list -- |             Filename      Size  Secrecy Value", nil},
+		{"list -- |          memo.docx     40 KB             75", nil},
+		{"list -- |          plans.pdf    200 KB             90", nil},
+		{"alice | ~tui /list", nil},
+		{"status -- | Time left: 80s  Score: 0  Hints: 0/3", nil},
+		{"status -- |                alice     120 KB", nil},
+		{"status -- |                  bob      90 KB", nil},
+		{"alice | ~tui /status", nil},
+		{"bob | hi", nil},
+		{"send -- | Sent file: memo.docx", []string{"/list", "/msg alice ~tui /list"}},
+	}
+	for _, l := range lines {
+		replies := s.Read(l.Line, now)
+		if len(replies) != len(l.Replies) || (len(replies) > 0 && !reflect.DeepEqual(replies, l.Replies)) {
+			t.Errorf("%q: expected replies %q, got %q", l.Line, l.Replies, replies)
+		}
+	}
+
+	if s.Name != "alice" || s.Room != "demo" {
+		t.Errorf("Expected alice in demo, got %q in %q", s.Name, s.Room)
+	}
+	if !reflect.DeepEqual(s.Commands, []string{"/help", "/look", "/send"}) {
+		t.Errorf("Expected the commands /help listed, got %q", s.Commands)
+	}
+	if s.NPC != "Glenda" || len(s.Team) != 3 || s.Team[1].Bandwidth != 90 {
+		t.Errorf("Unexpected team %v with %s", s.Team, s.NPC)
+	}
+	if s.Bandwidth != 120 || len(s.Files) != 2 || s.Files[1] != (FileInfo{"plans.pdf", 200, 90}) {
+		t.Errorf("Unexpected files %v with %d KB", s.Files, s.Bandwidth)
+	}
+	if left := s.TimeLeft(now); left != 80*time.Second {
+		t.Errorf("Expected 80s left, got %s", left)
+	}
+	// Answers to queries stay out of the chat
+	for _, line := range s.Lines {
+		if strings.HasPrefix(line, "list -- |") || strings.HasPrefix(line, "help -- |") || strings.Contains(line, QUERY_TAG) {
+			t.Errorf("Expected %q to be hidden", line)
+		}
+	}
+	if last := s.Lines[len(s.Lines)-1]; last != "send -- | Sent file: memo.docx" {
+		t.Errorf("Unexpected last line %q", last)
+	}
+
+	s.Read("Game ended. Score 75", now)
+	if s.Running || !s.Ended || s.Score != 75 {
+		t.Errorf("Expected the game to end with 75, got %d", s.Score)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	e := NewEditor()
+	e.InsertString("/lst")
+	e.Left()
+	e.Left()
+	e.Insert('i')
+	e.End()
+	if line := e.Submit(); line != "/list" {
+		t.Errorf("Expected /list, got %q", line)
+	}
+	e.InsertString("/look")
+	e.Submit()
+	e.InsertString("draft")
+	e.Up()
+	e.Up()
+	if string(e.Line) != "/list" {
+		t.Errorf("Expected /list from the history, got %q", string(e.Line))
+	}
+	e.Down()
+	e.Down()
+	if string(e.Line) != "draft" {
+		t.Errorf("Expected the draft back, got %q", string(e.Line))
+	}
+	e.Home()
+	e.Delete()
+	e.End()
+	e.Backspace()
+	if string(e.Line) != "raf" {
+		t.Errorf("Expected raf, got %q", string(e.Line))
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := NewState()
+	s.Name, s.NPC = "alice", "Glenda"
+	s.Commands = []string{"/help", "/list", "/msg", "/send"}
+	s.Team = []Teammate{{"alice", 0}, {"bob", 0}, {"Glenda", -1}}
+	s.Files = []FileInfo{{"memo.docx", 40, 75}, {"menu.txt", 5, 1}}
+	e := NewEditor()
+
+	steps := []struct {
+		Type    string
+		Line    string
+		Matches []string
+	}{
+		{"/se", "/send ", nil},
+		{"b", "/send bob ", nil},
+		{"m", "/send bob me", nil},
+		{"", "/send bob me", []string{"memo.docx", "menu.txt"}},
+		{"mo", "/send bob memo.docx ", nil},
+	}
+	for _, step := range steps {
+		e.InsertString(step.Type)
+		matches := e.Complete(s)
+		if string(e.Line) != step.Line || !reflect.DeepEqual(matches, step.Matches) {
+			t.Errorf("After %q expected %q and %q, got %q and %q", step.Type, step.Line, step.Matches, string(e.Line), matches)
+		}
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	keys, rest := DecodeKeys([]byte("é\x1b[A\x1b[5~\t\r\n\x1b["))
+	codes := make([]int, 0)
+	for _, k := range keys {
+		codes = append(codes, k.Code)
+	}
+	if !reflect.DeepEqual(codes, []int{KEY_RUNE, KEY_UP, KEY_PGUP, KEY_TAB, KEY_ENTER}) || keys[0].Rune != 'é' {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if string(rest) != "\x1b[" {
+		t.Errorf("Expected the cut off sequence left over, got %q", rest)
+	}
+}
+
+func TestRenderFits(t *testing.T) {
+	ansi := regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	s := NewState()
+	s.Name, s.Room, s.NPC, s.Running = "alice", "demo", "Glenda", true
+	s.Bandwidth, s.Capacity = 80, 120
+	s.Team = []Teammate{{"alice", 80}, {"bob", -1}, {"Glenda", -1}}
+	s.Files = []FileInfo{{"a_really_long_filename_for_the_pane.docx", 40, 75}, {"plans.pdf", 200, 90}}
+	for i := 0; i < 50; i++ {
+		s.Log("err -- | " + strings.Repeat("a long line that has to wrap ", 5))
+	}
+	e := NewEditor()
+	e.InsertString(strings.Repeat("x", 200))
+
+	for _, size := range [][2]int{{40, 10}, {80, 24}, {132, 50}} {
+		w, h := size[0], size[1]
+		scroll := 1000
+		screen := Render(s, e, &scroll, w, h, time.Now())
+		rows := strings.Split(screen, "\x1b[K")
+		if len(rows) != h+1 {
+			t.Errorf("%dx%d: expected %d rows, got %d", w, h, h, len(rows)-1)
+		}
+		for _, row := range rows[:len(rows)-1] {
+			if n := utf8.RuneCountInString(ansi.ReplaceAllString(row, "")); n > w {
+				t.Errorf("%dx%d: row is %d wide: %q", w, h, n, row)
+			}
+		}
+		if scroll <= 0 || scroll >= 1000 {
+			t.Errorf("%dx%d: expected the scroll to be clamped, got %d", w, h, scroll)
+		}
+	}
+}
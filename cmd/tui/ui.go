@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// How often the hidden /status refreshes the timer and the roster
+const POLL_INTERVAL time.Duration = 5 * time.Second
+
+// Lines PgUp and PgDn scroll by
+const SCROLL_STEP int = 10
+
+var ErrDisconnected = errors.New("disconnected from the server")
+
+type UI struct {
+	State  *State
+	Editor *Editor
+	Scroll int // Lines scrolled back from the bottom of the chat
+	Width  int
+	Height int
+
+	conn io.ReadWriter
+	term *Terminal
+}
+
+func NewUI(conn io.ReadWriter, term *Terminal) *UI {
+	return &UI{State: NewState(), Editor: NewEditor(), conn: conn, term: term}
+}
+
+// Run draws the screen until the player quits or the server hangs up
+func (ui *UI) Run() error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		bufr := bufio.NewReader(ui.conn)
+		for {
+			line, err := bufr.ReadString('\n')
+			if line = strings.TrimRight(line, "\r\n"); line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	input := make(chan []byte)
+	go func() {
+		defer close(input)
+		for {
+			buf := make([]byte, 256)
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				input <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastPoll := time.Now()
+	pending := make([]byte, 0)
+	ui.Width, ui.Height = ui.term.Size()
+	ui.Draw()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				ui.State.Log("tui -- | " + ErrDisconnected.Error() + ", press any key to quit")
+				ui.Draw()
+				<-input
+				return nil
+			}
+			if err := ui.Send(ui.State.Read(line, time.Now())...); err != nil {
+				return err
+			}
+		case buf, ok := <-input:
+			if !ok {
+				return nil
+			}
+			keys, rest := DecodeKeys(append(pending, buf...))
+			// A lone escape is the escape key, not the start of a sequence
+			if string(rest) == "\x1b" {
+				rest = rest[:0]
+			}
+			pending = append(pending[:0], rest...)
+			quit, err := ui.Keys(keys)
+			if quit || err != nil {
+				return err
+			}
+		case now := <-ticker.C:
+			if ui.State.Running && now.Sub(lastPoll) >= POLL_INTERVAL && ui.State.hiding[QueryPrefix("/status")] == 0 {
+				lastPoll = now
+				if err := ui.Send(ui.State.Query("/status")...); err != nil {
+					return err
+				}
+			}
+		case <-ui.term.Resize:
+			ui.Width, ui.Height = ui.term.Size()
+			ui.term.Write("\x1b[2J")
+		}
+		ui.Draw()
+	}
+}
+
+// Keys applies keys to the input line, and reports whether to quit
+func (ui *UI) Keys(keys []Key) (bool, error) {
+	e := ui.Editor
+	for _, k := range keys {
+		switch k.Code {
+		case KEY_RUNE:
+			e.Insert(k.Rune)
+		case KEY_ENTER:
+			line := e.Submit()
+			ui.Scroll = 0
+			ui.State.Type(line)
+			if err := ui.Send(line); err != nil {
+				return true, err
+			}
+		case KEY_BACKSPACE:
+			e.Backspace()
+		case KEY_DELETE:
+			e.Delete()
+		case KEY_TAB:
+			if matches := e.Complete(ui.State); len(matches) > 0 {
+				ui.State.Log("tui -- | " + strings.Join(matches, "  "))
+			}
+		case KEY_UP:
+			e.Up()
+		case KEY_DOWN:
+			e.Down()
+		case KEY_LEFT:
+			e.Left()
+		case KEY_RIGHT:
+			e.Right()
+		case KEY_HOME, KEY_CTRL_A:
+			e.Home()
+		case KEY_END, KEY_CTRL_E:
+			e.End()
+		case KEY_CTRL_U:
+			e.Kill()
+		case KEY_PGUP:
+			ui.Scroll += SCROLL_STEP
+		case KEY_PGDN:
+			ui.Scroll -= SCROLL_STEP
+			if ui.Scroll < 0 {
+				ui.Scroll = 0
+			}
+		case KEY_CTRL_L:
+			ui.term.Write("\x1b[2J")
+		case KEY_CTRL_C:
+			return true, nil
+		case KEY_CTRL_D:
+			if len(e.Line) == 0 {
+				return true, nil
+			}
+			e.Delete()
+		}
+	}
+	return false, nil
+}
+
+func (ui *UI) Send(lines ...string) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(ui.conn, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ui *UI) Draw() {
+	ui.term.Write(Render(ui.State, ui.Editor, &ui.Scroll, ui.Width, ui.Height, time.Now()))
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Phases of a game a command can be used in
+const (
+	PHASE_LOBBY = 1 << iota
+	PHASE_MISSION
+	PHASE_ANY = PHASE_LOBBY | PHASE_MISSION
+)
+
+// Width of the usage column in /help
+const HELP_COLUMN int = 24
+
+var (
+	ErrUnclosedQuote = errors.New("unclosed quote")
+	ErrUsage         = errors.New("wrong arguments")
+)
+
+type Arg struct {
+	Key      string // Message with the argument's name for usage lines
+	Required bool
+	Rest     bool     // Takes the rest of the line as typed, quotes and all
+	Number   bool     // A whole number above 0
+	Choices  []string // The only values it takes, when set
+
+	// Values tab completion offers on top of Choices
+	Values func(c *Client) []string
+}
+
+// Command is one of the slash commands players type
+type Command struct {
+	Name    string
+	Aliases []string
+	Args    []Arg
+	Phases  int
+	Help    string // Message describing what it does
+	Run     func(c *Client, args []string)
+}
+
+var COMMANDS []*Command
+
+// Filled in here since /help lists COMMANDS itself
+func init() {
+	COMMANDS = []*Command{
+		{Name: "msg", Aliases: []string{"m", "tell"}, Phases: PHASE_MISSION, Help: "cmd.msg",
+			Args: []Arg{{Key: "arg.to", Required: true, Values: agentNames}, {Key: "arg.text", Required: true, Rest: true}},
+			Run:  func(c *Client, args []string) { c.SendMsgTo(args[0], args[1]) }},
+		{Name: "list", Aliases: []string{"ls"}, Phases: PHASE_MISSION, Help: "cmd.list",
+			Run: func(c *Client, args []string) { c.ListFiles() }},
+		{Name: "send", Aliases: []string{"s"}, Phases: PHASE_MISSION, Help: "cmd.send",
+			Args: []Arg{{Key: "arg.to", Required: true, Values: agentNames}, {Key: "arg.filename", Required: true, Values: fileNames}},
+			Run:  func(c *Client, args []string) { c.SendFileTo(args[0], args[1]) }},
+		{Name: "look", Aliases: []string{"who"}, Phases: PHASE_ANY, Help: "cmd.look",
+			Run: func(c *Client, args []string) { c.Look() }},
+		{Name: "history", Aliases: []string{"h"}, Phases: PHASE_ANY, Help: "cmd.history",
+			Args: []Arg{{Key: "arg.number", Number: true}, {Key: "arg.from", Values: agentNames}},
+			Run:  func(c *Client, args []string) { c.ShowHistory(args[0], args[1]) }},
+		{Name: "hint", Phases: PHASE_MISSION, Help: "cmd.hint",
+			Run: func(c *Client, args []string) { c.Hint() }},
+		{Name: "status", Aliases: []string{"st"}, Phases: PHASE_ANY, Help: "cmd.status",
+			Args: []Arg{{Key: "arg.show_hide", Choices: []string{"show", "hide"}}},
+			Run:  func(c *Client, args []string) { c.Status(args[0]) }},
+		{Name: "difficulty", Aliases: []string{"diff"}, Phases: PHASE_ANY, Help: "cmd.difficulty",
+			Args: []Arg{{Key: "arg.level", Values: func(c *Client) []string { return DIFFICULTIES }}},
+			Run:  func(c *Client, args []string) { c.Difficulty(args[0]) }},
+		{Name: "campaign", Phases: PHASE_ANY, Help: "cmd.campaign",
+			Args: []Arg{{Key: "arg.number", Number: true}},
+			Run:  func(c *Client, args []string) { c.Campaign(args[0]) }},
+		{Name: "mode", Phases: PHASE_ANY, Help: "cmd.mode",
+			Args: []Arg{{Key: "arg.variant", Values: variantNames}, {Key: "arg.on_off", Choices: []string{"on", "off"}}},
+			Run:  func(c *Client, args []string) { c.Mode(args[0], args[1]) }},
+		{Name: "versus", Phases: PHASE_ANY, Help: "cmd.versus",
+			Args: []Arg{{Key: "arg.room"}, {Key: "arg.limit", Number: true}},
+			Run:  func(c *Client, args []string) { c.Versus(args[0], args[1]) }},
+		{Name: "register", Phases: PHASE_ANY, Help: "cmd.register",
+			Args: []Arg{{Key: "arg.password", Required: true}},
+			Run:  func(c *Client, args []string) { c.Register(args[0]) }},
+		{Name: "stats", Phases: PHASE_ANY, Help: "cmd.stats",
+			Args: []Arg{{Key: "arg.name", Values: agentNames}},
+			Run:  func(c *Client, args []string) { c.Stats(args[0]) }},
+		{Name: "ai", Phases: PHASE_ANY, Help: "cmd.ai",
+			Args: []Arg{{Key: "arg.fill", Choices: []string{"fill"}}},
+			Run:  func(c *Client, args []string) { c.AddAIs(args[0]) }},
+		{Name: "scenario", Phases: PHASE_ANY, Help: "cmd.scenario",
+			Args: []Arg{{Key: "arg.name", Values: func(c *Client) []string { return ScenarioNames() }}},
+			Run:  func(c *Client, args []string) { c.PickScenario(args[0]) }},
+		{Name: "lang", Aliases: []string{"language"}, Phases: PHASE_ANY, Help: "cmd.lang",
+			Args: []Arg{{Key: "arg.code", Values: func(c *Client) []string { return Langs() }}},
+			Run:  func(c *Client, args []string) { c.Language(args[0]) }},
+		{Name: "help", Aliases: []string{"?"}, Phases: PHASE_ANY, Help: "cmd.help",
+			Args: []Arg{{Key: "arg.command", Values: commandNames}},
+			Run:  func(c *Client, args []string) { c.Help(args[0]) }},
+	}
+}
+
+// FindCommand looks a command up by its name or an alias, with or without
+// the slash
+func FindCommand(name string) *Command {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	for _, cmd := range COMMANDS {
+		if cmd.Name == name {
+			return cmd
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// Parse splits what was typed after the command into its arguments, one
+// for each in the schema and "" for those left out. Quotes keep spaces in
+// an argument.
+func (cmd *Command) Parse(line string) ([]string, error) {
+	args := make([]string, len(cmd.Args))
+	rest := strings.TrimSpace(line)
+	for i, arg := range cmd.Args {
+		if arg.Rest {
+			args[i], rest = strings.TrimLeft(rest, " \t"), ""
+		} else {
+			var err error
+			if args[i], rest, err = NextWord(rest); err != nil {
+				return nil, err
+			}
+		}
+		if args[i] == "" {
+			if arg.Required {
+				return nil, ErrUsage
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(args[i]); arg.Number && (err != nil || n < 1) {
+			return nil, ErrUsage
+		}
+		if arg.Choices != nil && !contains(arg.Choices, args[i]) {
+			return nil, ErrUsage
+		}
+	}
+	if rest != "" {
+		return nil, ErrUsage
+	}
+	return args, nil
+}
+
+// NextWord takes the first word off line. A word in single or double quotes
+// can hold spaces, and a backslash in it escapes the next character.
+func NextWord(line string) (string, string, error) {
+	line = strings.TrimLeft(line, " \t")
+	if line == "" {
+		return "", "", nil
+	}
+	quote := line[0]
+	if quote != '"' && quote != '\'' {
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			return line[:i], line[i+1:], nil
+		}
+		return line, "", nil
+	}
+	var word strings.Builder
+	for i := 1; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+		case line[i] == quote:
+			return word.String(), line[i+1:], nil
+		default:
+			word.WriteByte(line[i])
+		}
+	}
+	return "", "", ErrUnclosedQuote
+}
+
+// TypedWords splits a line being typed with NextWord's quoting: the words
+// before the one at the end, and where that one starts. A line ending in a
+// space starts a new word.
+func TypedWords(line string) ([]string, int) {
+	words := make([]string, 0)
+	start := 0
+	for {
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+		if start == len(line) {
+			return words, start
+		}
+		word, rest, err := NextWord(line[start:])
+		if err != nil || rest == "" && !strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\t") {
+			return words, start
+		}
+		words = append(words, word)
+		start = len(line) - len(rest)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Completions is what the word at the end of line could be, for tab
+// completion: a command, or a value of the argument being typed
+func (c *Client) Completions(line string) []string {
+	words, _ := TypedWords(line)
+	typing := len(words)
+	if typing == 0 {
+		names := make([]string, 0, len(COMMANDS))
+		for _, name := range commandNames(c) {
+			names = append(names, "/"+name)
+		}
+		return names
+	}
+	cmd := FindCommand(words[0])
+	if cmd == nil || typing > len(cmd.Args) || cmd.Args[typing-1].Rest {
+		return nil
+	}
+	arg := cmd.Args[typing-1]
+	values := append([]string{}, arg.Choices...)
+	if arg.Values != nil {
+		values = append(values, arg.Values(c)...)
+	}
+	for i, v := range values {
+		if strings.ContainsAny(v, " \t") {
+			values[i] = `"` + strings.Replace(v, `"`, `\"`, -1) + `"`
+		}
+	}
+	return values
+}
+
+func commandNames(c *Client) []string {
+	names := make([]string, 0, len(COMMANDS))
+	for _, cmd := range COMMANDS {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+// agentNames are the teammates c can talk to or send files to. Completion
+// runs on the connection's goroutine, so it goes by the game's last view of
+// the team.
+func agentNames(c *Client) []string {
+	v := c.View()
+	if v == nil {
+		return nil
+	}
+	names := []string{v.NPC}
+	for _, other := range v.Agents {
+		if other.Name != c.Name {
+			names = append(names, other.Name)
+		}
+	}
+	return names
+}
+
+func fileNames(c *Client) []string {
+	v := c.View()
+	if v == nil {
+		return nil
+	}
+	me, _ := v.Agent(c.Name)
+	names := make([]string, 0, len(me.Files))
+	for _, f := range me.Files {
+		names = append(names, f.Filename)
+	}
+	return names
+}
+
+func variantNames(c *Client) []string {
+	names := make([]string, 0, len(VARIANTS))
+	for _, v := range VARIANTS {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// Usage is how to type cmd, in c's language
+func (cmd *Command) Usage(c *Client) string {
+	usage := "/" + cmd.Name
+	for _, arg := range cmd.Args {
+		usage += " [" + c.Tr(arg.Key) + "]"
+	}
+	return usage
+}
+
+// ParseInput runs the command in a line the player typed
+func (c *Client) ParseInput(input string) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "/") {
+		// Toss chatter in the lobby
+		if c.Game.Status != LOBBY {
+			c.Tell("err.invalid_command")
+		}
+		return
+	}
+	name, rest := input, ""
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		name, rest = input[:i], input[i+1:]
+	}
+	cmd := FindCommand(name)
+	if cmd == nil {
+		c.Tell("err.invalid_command")
+		return
+	}
+	switch {
+	case c.Game.Status == LOBBY && cmd.Phases&PHASE_LOBBY == 0:
+		c.Tell("cmd.mission_only", "/"+cmd.Name)
+		return
+	case c.Game.Status != LOBBY && cmd.Phases&PHASE_MISSION == 0:
+		c.Tell("cmd.lobby_only", "/"+cmd.Name)
+		return
+	}
+	args, err := cmd.Parse(rest)
+	switch err {
+	case nil:
+		cmd.Run(c, args)
+	case ErrUnclosedQuote:
+		c.Tell("cmd.quote", cmd.Usage(c))
+	default:
+		c.Tell("cmd.usage", cmd.Usage(c))
+	}
+}
+
+// Help lists the commands, or explains the one called name
+func (c *Client) Help(name string) {
+	if name == "" {
+		text := c.Tr("help.header")
+		indent := utf8.RuneCountInString(strings.TrimSuffix(c.Tr("help.row", HELP_COLUMN, "", ""), "\n"))
+		for _, cmd := range COMMANDS {
+			usage := cmd.Usage(c)
+			for _, line := range c.WrapHelp(c.Tr(cmd.Help), indent) {
+				text += c.Tr("help.row", -HELP_COLUMN, usage, line)
+				usage = ""
+			}
+		}
+		c.MsgCh <- Message{Text: text + c.Tr("help.footer", FindCommand("help").Usage(c))}
+		return
+	}
+
+	cmd := FindCommand(name)
+	if cmd == nil {
+		c.Tell("help.unknown", name)
+		return
+	}
+	text := c.Tr("help.usage", cmd.Usage(c))
+	if len(cmd.Aliases) > 0 {
+		text += c.Tr("help.aliases", "/"+strings.Join(cmd.Aliases, ", /"))
+	}
+	for _, line := range c.WrapHelp(c.Tr(cmd.Help), utf8.RuneCountInString(strings.TrimSuffix(c.Tr("help.line", ""), "\n"))) {
+		text += c.Tr("help.line", line)
+	}
+	switch cmd.Phases {
+	case PHASE_LOBBY:
+		text += c.Tr("help.lobby_only")
+	case PHASE_MISSION:
+		text += c.Tr("help.mission_only")
+	}
+	c.MsgCh <- Message{Text: text}
+}
+
+// WrapHelp breaks text into lines that fit c's terminal after indent
+// columns
+func (c *Client) WrapHelp(text string, indent int) []string {
+	width := c.Width() - indent
+	if width < 20 {
+		width = 20
+	}
+	lines := make([]string, 0)
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, cmd := range COMMANDS {
+		keys := []string{cmd.Help}
+		for _, arg := range cmd.Args {
+			keys = append(keys, arg.Key)
+		}
+		for _, key := range keys {
+			if _, ok := Catalogs[SOURCE_LANG].Messages[key]; !ok {
+				t.Errorf("/%s: no message %s", cmd.Name, key)
+			}
+		}
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if seen[name] {
+				t.Errorf("/%s: %s is taken", cmd.Name, name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		Cmd  string
+		Line string
+		Args []string
+		Err  error
+	}{
+		{"send", `bob "my file.txt"`, []string{"bob", "my file.txt"}, nil},
+		{"send", `bob 'it\'s.txt'`, []string{"bob", "it's.txt"}, nil},
+		{"send", `bob "my file.txt`, nil, ErrUnclosedQuote},
+		{"send", `bob`, nil, ErrUsage},
+		{"send", `bob a.txt b.txt`, nil, ErrUsage},
+		{"msg", `  bob  "quoted" and   spaced`, []string{"bob", `"quoted" and   spaced`}, nil},
+		{"status", ``, []string{""}, nil},
+		{"status", `bogus`, nil, ErrUsage},
+		{"versus", `rivals 3`, []string{"rivals", "3"}, nil},
+		{"versus", `rivals 0`, nil, ErrUsage},
+	}
+	for _, test := range tests {
+		args, err := FindCommand(test.Cmd).Parse(test.Line)
+		if err != test.Err || !reflect.DeepEqual(args, test.Args) {
+			t.Errorf("/%s %s: expected %q, %v, got %q, %v", test.Cmd, test.Line, test.Args, test.Err, args, err)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Run([]Step{
+		{Send: "/send bob a.txt", Expect: []string{"err -- | /send only works once the mission starts"}},
+		{Send: "/help send", Expect: []string{"help -- |  Usage: /send [to] [filename]", "help -- |  Also: /s", "help -- |  move file", "help -- |  Only once the mission starts"}},
+		{Send: "/? nothing", Expect: []string{"There's no /nothing command"}},
+		{Send: "/HELP", Expect: []string{"/status [show|hide]      show the mission status", "hide teammates' bandwidth", "/help [cmd] explains one command"}},
+		{Send: "/status bogus", Expect: []string{"err -- | Usage: /status [show|hide]"}},
+		{Send: "/register", Expect: []string{"err -- | Usage: /register [password]"}},
+	})
+
+	bob := s.Join(room, "bob")
+	carl := s.Join(room, "carl")
+	for _, p := range []*TestPlayer{alice, bob, carl} {
+		p.Expect("mission starting")
+	}
+	alice.Run([]Step{
+		{Send: "/ls", Expect: []string{"list -- | Remaining Bandwidth"}},
+		{Send: `/s bob "no such file`, Expect: []string{"err -- | A quote isn't closed. Usage: /send [to] [filename]"}},
+		{Send: `/tell bob "hi" there`, Expect: nil},
+	})
+	bob.Expect(`alice | "hi" there`)
+}
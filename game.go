@@ -2,11 +2,12 @@ package main
 
 import (
 	"bufio"
-	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,65 +19,148 @@ const (
 )
 
 const MAX_NUM_CLIENTS int = 3
-const TIMEOUT int = 60
+
+// Largest team any mission can have
+const MAX_TEAM_SIZE int = 5
+
+// How long a lobby waits for its team before the game gives up
+const LOBBY_TIMEOUT = 10 * time.Minute
 
 type Message struct {
-	From string
-	To   string
-	Text string
+	From   string
+	To     string
+	Text   string
+	Notice bool // Told to the whole team, kept in the history
 }
 
 type File struct {
-	Filename string
-	Size     int
-	Secrecy  int
+	Filename  string
+	Size      int
+	Secrecy   int
+	Costs     []int  // Costs in the puzzle's other resources
+	Clearance string // Only agents with this clearance can send it, "" for anyone
 }
 
+// Everything about a game is read and changed on its goroutine, Start.
+// Players' commands and work from other goroutines reach it through its
+// channels.
 type Game struct {
-	Name       string
-	Clients    map[string]*Client
-	DoneClient chan bool
-	AddCh      chan *Client
-	RmCh       chan *Client
-	MsgCh      chan Message
-	FileCh     chan File
-	Files      []File
-	Score      int
-	Status     int
+	Name          string
+	Clients       map[string]*Client
+	AddCh         chan *Client
+	RmCh          chan *Client
+	InputCh       chan Input
+	CallCh        chan func()
+	Ended         chan bool // Closed once the game is over
+	Files         []File
+	Score         int
+	Puzzle        Puzzle
+	Par           int
+	HintsUsed     int
+	Status        int
+	FailReason    Text
+	Owner         string
+	ShowBandwidth bool
+	Difficulty    int
+	Clock         *MissionClock
+	Rand          *rand.Rand
+	Glenda        *Dialogue
+	Scenario      *Scenario
+	TeamSize      int
+	Variants      map[string]bool
+	Mission       *Mission
+	Campaigns     *CampaignStore
+	Accounts      *AccountStore
+	Profiles      *ProfileStore
+	Building      *Building   // Shared with a rival team in versus mode
+	Challenges    *Challenges // Between the rooms of the game's server
+	LostCh        chan Loss
+	FillAfter     time.Duration             // Lobby wait before AI agents fill the team, 0 for never
+	History       map[string][]HistoryEntry // What each player was shown, by name
+	historyMu     sync.Mutex
+	aiCount       int
+	view          *TeamView // Last one handed to the players
+	numDone       int
+	over          bool
+	initOnce      sync.Once
+}
+
+// Input is a line a player typed, for their game to run
+type Input struct {
+	Client *Client
+	Text   string
+}
+
+// Stores are where games save campaign progress, accounts and profiles
+type Stores struct {
+	Campaigns *CampaignStore
+	Accounts  *AccountStore
+	Profiles  *ProfileStore
+}
+
+// DefaultStores are the stores named by the environment
+func DefaultStores() Stores {
+	return Stores{Campaigns: Campaigns, Accounts: Accounts, Profiles: Profiles}
+}
+
+// MemoryStores keeps everything in memory, for games nobody needs to
+// remember
+func MemoryStores() Stores {
+	return Stores{Campaigns: NewCampaignStore(""), Accounts: NewAccountStore(""), Profiles: NewProfileStore("")}
 }
 
 type GameRequest struct {
 	Name string
 	Ch   chan *Game // Channel on which to send game back to requester
+	// Set for quick play, the client waits in the matchmaking queue instead
+	Client *Client
+	Left   bool // The queued client's connection dropped
 }
 
-func NewGame(name string) *Game {
+func NewGame(name string, clock Clock, rng *rand.Rand) *Game {
+	scenario := FindScenario(DefaultScenario)
 	return &Game{
-		Name:       name,
-		Clients:    make(map[string]*Client),
-		DoneClient: make(chan bool, MAX_NUM_CLIENTS),
-		AddCh:      make(chan *Client, MAX_NUM_CLIENTS),
-		RmCh:       make(chan *Client, MAX_NUM_CLIENTS),
-		MsgCh:      make(chan Message),
-		FileCh:     make(chan File, 5), // TODO do I really need a buffered chan
-		Files:      make([]File, 0),
-		Score:      0,
-		Status:     LOBBY,
+		Name:          name,
+		Clients:       make(map[string]*Client),
+		AddCh:         make(chan *Client, MAX_TEAM_SIZE),
+		RmCh:          make(chan *Client, MAX_TEAM_SIZE),
+		InputCh:       make(chan Input),
+		CallCh:        make(chan func()),
+		Ended:         make(chan bool),
+		Files:         make([]File, 0),
+		Score:         0,
+		Status:        LOBBY,
+		ShowBandwidth: true,
+		Difficulty:    NORMAL,
+		Clock:         NewMissionClock(clock, scenario.Duration(NORMAL), MISSION_WARNINGS),
+		Rand:          rng,
+		Glenda:        scenario.Dialogue,
+		Scenario:      scenario,
+		TeamSize:      MAX_NUM_CLIENTS,
+		Variants:      make(map[string]bool),
+		Campaigns:     Campaigns,
+		Accounts:      Accounts,
+		Profiles:      Profiles,
+		Challenges:    NewChallenges(),
+		LostCh:        make(chan Loss, MAX_FILES),
+		FillAfter:     LobbyFillWait,
+		History:       make(map[string][]HistoryEntry),
 	}
 }
 
-func ConnectionHandler(connCh chan net.Conn, gameRequestCh chan GameRequest) {
+func ConnectionHandler(connCh chan net.Conn, gameRequestCh chan GameRequest, stores Stores) {
 	for conn := range connCh {
 		client := NewClient(conn)
-		if err := client.WriteString(INTRO_MSG); err != nil {
+		intro := client.Tr(INTRO_MSG) + client.Tr("lang.hint", strings.Join(Langs(), ", "))
+		if err := client.WriteString(intro); err != nil {
 			log.Printf("Error occured while writing: %s", err.Error())
 			continue
 		}
-		go JoinGame(client, gameRequestCh)
+		go JoinGame(client, gameRequestCh, stores)
 	}
 }
 
-func JoinGame(client *Client, gameRequestCh chan GameRequest) {
+func JoinGame(client *Client, gameRequestCh chan GameRequest, stores Stores) {
 	// Get game name from client. Send request for game and then join it
 	bufw := bufio.NewWriter(client.RWC)
 	re := regexp.MustCompile(`^\w+$`)
@@ -88,8 +172,12 @@ func JoinGame(client *Client, gameRequestCh chan GameRequest) {
 		}
 
 		gameName = re.FindString(gameName)
+		if gameName == QUICK_PLAY {
+			QuickPlay(client, gameRequestCh, stores)
+			return
+		}
 		if gameName == "" {
-			if _, err := bufw.WriteString("Invalid channel\n"); err != nil {
+			if _, err := bufw.WriteString(client.Tr("prompt.invalid_room")); err != nil {
 				log.Printf("Error occuring while writing: %s\n", err.Error())
 				return
 			}
@@ -105,27 +193,80 @@ func JoinGame(client *Client, gameRequestCh chan GameRequest) {
 			Ch:   ch,
 		}
 		game := <-ch
-		game.AddCh <- client
+		if game.Full() {
+			if err := client.WriteString(client.Tr(FULL_MSG)); err != nil {
+				log.Printf("Error occured while writing full msg: %s", err.Error())
+			}
+			client.End()
+			return
+		}
+		name, err := client.GetName(game.Accounts)
+		if err != nil {
+			log.Printf("Error getting name: %s", err.Error())
+			client.End()
+			return
+		}
+		client.Name = name
+		game.Add(client)
 		return
 	}
 }
 
-func GameHandler(requestCh chan GameRequest) {
+func GameHandler(requestCh chan GameRequest, clock Clock, seed int64, stores Stores) {
 	// Handles all requests for games. Creates new games it they do not exist and starts them
+	// Every game gets its own random source drawn from seed, so the same seed
+	// replays the same puzzles in the same order
+	seeds := NewRand(seed)
 	games := make(map[string]*Game)
 	done := make(chan *Game)
+	queue := NewMatchQueue(clock, MatchSkillSpread)
+	tick := clock.After(MATCH_INTERVAL)
+	challenges := NewChallenges()
+
+	newGame := func(name string) *Game {
+		log.Printf("Creating a new game \"%s\"", name)
+		game := NewGame(name, clock, NewRand(seeds.Int63()))
+		game.Campaigns = stores.Campaigns
+		game.Accounts = stores.Accounts
+		game.Profiles = stores.Profiles
+		game.Challenges = challenges
+		games[name] = game
+		go game.Start(done)
+		return game
+	}
+	matchTeams := func() {
+		for _, team := range queue.Match() {
+			game := newGame(queue.RoomName())
+			for _, client := range team {
+				client.unqueued <- true
+				game.AddCh <- client
+			}
+		}
+	}
 
 	for {
 		select {
+		case <-tick:
+			tick = clock.After(MATCH_INTERVAL)
+			matchTeams()
 		case request := <-requestCh:
+			if request.Left {
+				if queue.Remove(request.Client) {
+					log.Printf("Player \"%s\" left the queue", request.Client.Name)
+					request.Client.unqueued <- true
+					request.Client.End()
+				}
+				continue
+			}
+			if request.Client != nil {
+				queue.Add(request.Client, Rating(stores.Profiles, request.Client))
+				matchTeams()
+				continue
+			}
 			gameName := request.Name
 			game, ok := games[gameName]
 			if !ok {
-				// Create a new game with name
-				log.Printf("Creating a new game \"%s\"", gameName)
-				game = NewGame(gameName)
-				games[gameName] = game
-				go game.Start(done)
+				game = newGame(gameName)
 			}
 			request.Ch <- game
 		case game := <-done:
@@ -137,56 +278,192 @@ func GameHandler(requestCh chan GameRequest) {
 
 func (g *Game) Start(done chan *Game) {
 	log.Printf("Starting game %s", g.Name)
-	go g.FileHandler()
-	go g.ClientHandler()
-	go g.MsgHandler()
+	lobby := g.Clock.Time.After(LOBBY_TIMEOUT)
+	var fill <-chan time.Time
+	if g.FillAfter > 0 {
+		fill = g.Clock.Time.After(g.FillAfter)
+	}
 
-	numDone := 0
-loop:
-	for {
+	nudged := false
+	for !g.over {
 		select {
-		case <-time.After(time.Duration(TIMEOUT) * time.Second):
-			log.Printf("Game %s has timed out", g.Name)
-			g.Status = FAIL
-			break loop
-		case <-g.DoneClient:
-			numDone += 1
-			if numDone >= MAX_NUM_CLIENTS {
-				break loop
+		case client := <-g.AddCh:
+			g.Join(client)
+		case client := <-g.RmCh:
+			g.Leave(client)
+		case input := <-g.InputCh:
+			// Lines typed just before leaving can arrive after
+			if g.Clients[input.Client.Name] == input.Client {
+				input.Client.ParseInput(input.Text)
+			}
+		case call := <-g.CallCh:
+			call()
+		case left := <-g.Clock.Warning:
+			g.MsgAll(TIME_WARNING_MSG, int(left.Seconds()))
+			if r := g.Glenda.Reaction(LOW_TIME_EVENT); r != nil && !nudged && left <= time.Duration(r.Threshold)*time.Second {
+				nudged = true
+				g.MsgEach(func(c *Client) string {
+					return g.GlendaFor(c).React(LOW_TIME_EVENT, g.DialogueContext(nil), g.Rand)
+				})
 			}
+		case <-fill:
+			g.FillWithAI()
+		case <-lobby:
+			if g.Status == LOBBY {
+				log.Printf("Game %s gave up waiting for its team", g.Name)
+				g.MsgAll(LOBBY_MSG)
+				g.over = true
+			}
+		case <-g.Clock.Timeout:
+			log.Printf("Game %s has timed out", g.Name)
+			g.Fail("fail.too_long")
+			g.over = true
+		case loss := <-g.LostCh:
+			g.Lose(loss)
 		}
+		g.Publish()
 	}
+	close(g.Ended)
+	g.Challenges.Withdraw(g)
 
 	switch g.Status {
 	case EXIT:
 		g.MsgAll(LEFT_MSG)
 	case FAIL:
+		if g.FailReason.Key != "" {
+			g.MsgAll("fail.reason", g.FailReason)
+		}
 		g.MsgAll(FAIL_MSG)
 	case RUNNING:
-		// TODO calculate score
-		scoreText := fmt.Sprintf("Game ended. Score %d\n", g.Score)
-		g.MsgAll(scoreText)
+		if g.HintsUsed > 0 {
+			g.MsgAll("game.score_hints", g.FinalScore(), g.Score, g.HintsUsed*HINT_PENALTY, g.HintsUsed)
+		} else {
+			g.MsgAll("game.score", g.FinalScore())
+		}
+		percent := g.PercentOfPar()
+		g.MsgAll("game.par", g.Par, percent)
+		if g.Mission != nil {
+			g.RecordMission(percent)
+		}
+	}
+	if g.Clock.Running() {
+		g.RecordProfiles()
 	}
 	log.Printf("Ending game \"%s\"", g.Name)
-	g.EndClients()
+	g.Clock.Stop()
+	if g.Building != nil {
+		g.Building.Finish(g)
+	} else {
+		g.EndClients()
+	}
 	done <- g
 }
 
+// Add hands a named client to the game to join
+func (g *Game) Add(client *Client) {
+	select {
+	case g.AddCh <- client:
+	case <-g.Ended:
+		client.WriteString(client.Tr(FULL_MSG))
+		client.End()
+	}
+}
+
+// Call runs f on the game's goroutine and waits for it, it reports false if
+// the game ended first
+func (g *Game) Call(f func()) bool {
+	called := make(chan bool)
+	select {
+	case g.CallCh <- func() { f(); close(called) }:
+	case <-g.Ended:
+		return false
+	}
+	<-called
+	return true
+}
+
+// Post runs f on the game's goroutine without waiting for it, or gone if
+// the game ends first. Games reach each other this way, two games waiting
+// on each other would never get anywhere.
+func (g *Game) Post(f func(), gone func()) {
+	go func() {
+		select {
+		case g.CallCh <- f:
+		case <-g.Ended:
+			if gone != nil {
+				gone()
+			}
+		}
+	}()
+}
+
+// Full reports whether there is no room left on the team
+func (g *Game) Full() bool {
+	full := true
+	g.Call(func() { full = len(g.Clients) >= g.TeamSize })
+	return full
+}
+
+// CheckFull starts the mission once the team has filled up
+func (g *Game) CheckFull() {
+	if g.Status == LOBBY && len(g.Clients) == g.TeamSize {
+		if g.Building != nil {
+			g.Building.Ready(g)
+			return
+		}
+		g.Init()
+	}
+}
+
 func (g *Game) Init() {
-	log.Printf("Initializing game %s", g.Name)
-	g.Status = RUNNING
-	g.LoadFiles()
-	g.MsgAll(START_MSG)
+	g.initOnce.Do(func() {
+		log.Printf("Initializing game %s", g.Name)
+		g.Status = RUNNING
+		g.LoadFiles()
+		g.Clock.Begin()
+		g.MsgAll(START_MSG)
+		if g.Mission != nil {
+			g.MsgAll(g.Mission.Key + ".intro")
+		}
+		g.MsgAll(CLOCK_MSG, int(g.Clock.Duration.Seconds()))
+	})
+}
+
+// PercentOfPar is the final score as a percentage of the best possible
+func (g *Game) PercentOfPar() int {
+	if g.Par <= 0 {
+		return 100
+	}
+	return g.FinalScore() * 100 / g.Par
 }
 
 func (g *Game) End(status int) {
-	// TODO is this all I need to do?
 	g.Status = status
-	//close(g.FileCh)
-	//close(g.MsgCh)
-	for i := 0; i < MAX_NUM_CLIENTS; i++ {
-		g.DoneClient <- true
+	g.over = true
+}
+
+// Fail marks the mission as failed, the team finds out when it ends. The
+// reason is a message key and its arguments.
+func (g *Game) Fail(key string, args ...interface{}) {
+	reason := T(key, args...)
+	log.Printf("Game %s failed: %s", g.Name, reason.Error())
+	if g.FailReason.Key == "" {
+		g.FailReason = reason
+	}
+	g.Status = FAIL
+}
+
+// Resources are the puzzle's resources besides bandwidth
+func (g *Game) Resources() []Resource {
+	if g == nil {
+		return nil
 	}
+	return g.Puzzle.Resources
+}
+
+// HasClearances reports whether files need clearance to send
+func (g *Game) HasClearances() bool {
+	return g != nil && len(g.Puzzle.Clearances) > 0
 }
 
 func (g *Game) EndClients() {
@@ -195,125 +472,217 @@ func (g *Game) EndClients() {
 	}
 }
 
-func (g *Game) ClientHandler() {
-	for {
-		select {
-		case client := <-g.AddCh:
-			// maximum 3 clients per game
-			if len(g.Clients) >= MAX_NUM_CLIENTS {
-				// Kick the Client
-				if err := client.WriteString(FULL_MSG); err != nil {
-					log.Printf("Error occured while writing full msg: %s", err.Error())
-				}
-				client.End()
-				continue
-			}
+// Join adds a named client to the team, unless the team is full or someone
+// already took the name
+func (g *Game) Join(client *Client) {
+	if len(g.Clients) >= g.TeamSize {
+		if err := client.WriteString(client.Tr(FULL_MSG)); err != nil {
+			log.Printf("Error occured while writing full msg: %s", err.Error())
+		}
+		client.End()
+		return
+	}
+	name := client.Name
+	if _, ok := g.Clients[name]; ok {
+		log.Printf("Error name \"%s\" taken", name)
+		client.WriteString(client.Tr("prompt.name_taken"))
+		client.End()
+		return
+	}
 
-			// Get name
-			// TODO do this asynchronously
-			name, err := client.GetName()
-			if err != nil {
-				log.Printf("Error getting name: %s", err.Error())
-				client.End()
-				continue
-			}
-			client.Name = name
+	if len(g.Clients) == 0 {
+		g.Owner = client.Name
+	}
+	g.Clients[client.Name] = client
+	client.Game = g
+	client.Start()
+	log.Printf("New player \"%s\" has joined game \"%s\"", client.Name, g.Name)
+	g.MsgAll("game.joined", client.Name, g.Name)
+	g.CheckFull()
+}
 
-			// Check if clients already exist with name
-			if _, ok := g.Clients[name]; ok {
-				log.Printf("Error name \"%s\" taken", name)
-				client.WriteString("Error name taken.\n")
-				client.End()
-				continue
-			}
+// Leave ends the game when a player leaves it
+func (g *Game) Leave(client *Client) {
+	if g.Clients[client.Name] != client {
+		return
+	}
+	log.Printf("Player \"%s\" has left game \"%s\"", client.Name, g.Name)
+	// Walking out of a mission goes on their record
+	if g.Clock.Running() {
+		g.RecordProfile(client, EXIT)
+	}
+	delete(g.Clients, client.Name)
+	g.MsgAll("game.player_left", client.Name, g.Name)
+	g.End(EXIT)
+}
 
-			g.Clients[client.Name] = client
-			client.Game = g
-			client.Start()
-			log.Printf("New player \"%s\" has joined game \"%s\"", client.Name, g.Name)
-			g.MsgAll(fmt.Sprintf("--> | %s has joined %s, waiting for teammates...\n", client.Name, client.Game.Name))
-			if len(g.Clients) == MAX_NUM_CLIENTS {
-				g.Init()
-			}
-		case client := <-g.RmCh:
-			// TODO cancel game when someone leaves
-			log.Printf("Player \"%s\" has left game \"%s\"", client.Name, g.Name)
-			delete(g.Clients, client.Name)
-			g.MsgAll(fmt.Sprintf("--> | %s has left %s\n", client.Name, client.Game.Name))
-			g.End(EXIT)
+// Received reports whether Glenda already has filename
+func (g *Game) Received(filename string) bool {
+	for _, f := range g.Files {
+		if f.Filename == filename {
+			return true
 		}
 	}
+	return false
 }
 
-func (g *Game) FileHandler() {
-	for file := range g.FileCh {
-		log.Printf("Game %s received file %s", g.Name, file.Filename)
-		g.Files = append(g.Files, file)
-		g.Score += file.Secrecy
+func (g *Game) ReceiveFile(file File) {
+	log.Printf("Game %s received file %s", g.Name, file.Filename)
+	for _, c := range g.Puzzle.Constraints {
+		if c.Kind == CONFLICTS && g.Received(c.Partner(file.Filename)) {
+			g.Fail("fail.conflict", c.Partner(file.Filename), file.Filename)
+		}
+	}
+	g.Files = append(g.Files, file)
+	g.Score = g.Puzzle.Score(g.Files)
+	if r := g.Glenda.Reaction(BIG_TRANSFER_EVENT); r != nil && file.Secrecy >= r.Threshold {
+		ctx := g.DialogueContext(nil)
+		ctx.File = file
+		g.MsgEach(func(c *Client) string {
+			return g.GlendaFor(c).React(BIG_TRANSFER_EVENT, ctx, g.Rand)
+		})
 	}
 }
 
-func (g *Game) MsgHandler() {
-	for msg := range g.MsgCh {
-		from := g.Clients[msg.From]
-		if msg.To == "Glenda" {
-			if msg.Text == "done" {
-				from.DoneSendingFiles = true
-				g.DoneClient <- true
-				continue
-			} else {
-				from.MsgCh <- Message{Text: GLENDA_MSG}
-				continue
-			}
-		}
-		to, ok := g.Clients[msg.To]
-		if ok {
-			msg.Text = fmt.Sprintf("%s | %s\n", msg.From, msg.Text)
-			to.MsgCh <- msg
+// Route delivers a chat message, or hands it to the NPC
+func (g *Game) Route(msg Message) {
+	from := g.Clients[msg.From]
+	if msg.To == g.NPC() {
+		if msg.Text == "done" {
+			g.ClientDone(from)
 		} else {
-			from.MsgCh <- Message{Text: fmt.Sprintf("err -- | Client \"%s\" does not exist\n", msg.To)}
+			from.MsgCh <- Message{From: g.NPC(), Text: g.GlendaFor(from).Respond(msg.Text, g.DialogueContext(from), g.Rand)}
 		}
+		return
+	}
+	to, ok := g.Clients[msg.To]
+	if ok {
+		msg.Text = to.Tr("msg.chat", msg.From, msg.Text)
+		to.MsgCh <- msg
+	} else {
+		from.Tell("msg.no_client", msg.To)
 	}
 }
 
-func (g *Game) MsgAll(text string) {
-	msg := Message{Text: text}
-	for _, c := range g.Clients {
-		c.MsgCh <- msg
+// ClientDone counts c as done sending files, the game ends once the whole
+// team is
+func (g *Game) ClientDone(c *Client) {
+	c.DoneSendingFiles = true
+	g.numDone++
+	if g.numDone >= g.TeamSize {
+		g.over = true
 	}
 }
 
-func (g *Game) LoadFiles() error {
-	capacities := []int{50, 81, 120}
-	files := GenerateFiles()
+func (g *Game) TimeLeft() time.Duration {
+	return g.Clock.Remaining()
+}
 
-	totalFiles := 0
-outer:
-	for {
-		// TODO randomize order
-		for _, c := range g.Clients {
-			c.Files = append(c.Files, files[totalFiles])
-			totalFiles++
-			if totalFiles >= 10 {
-				break outer
-			}
+// DialogueContext describes the game as Glenda sees it when talking to c
+func (g *Game) DialogueContext(c *Client) DialogueContext {
+	ctx := DialogueContext{
+		Files:    len(g.Files),
+		Score:    g.Score,
+		TimeLeft: int(g.TimeLeft().Seconds()),
+		Team:     g.TeamSize,
+	}
+	for _, client := range g.Clients {
+		if client.DoneSendingFiles {
+			ctx.Done++
 		}
 	}
+	if c != nil {
+		ctx.Name = c.Name
+		ctx.Bandwidth = c.Bandwidth
+	}
+	return ctx
+}
 
-	i := 0
+// MsgAll sends every player the message under key, in their language
+func (g *Game) MsgAll(key string, args ...interface{}) {
 	for _, c := range g.Clients {
-		c.Bandwidth = capacities[i]
-		i++
+		c.MsgCh <- Message{Text: c.Tr(key, args...), Notice: true}
+	}
+}
+
+// MsgEach sends every player the text render makes for them, in the same
+// order every time so renders that draw from the game's random source
+// replay the same
+func (g *Game) MsgEach(render func(c *Client) string) {
+	for _, c := range g.SortedClients() {
+		if text := render(c); text != "" {
+			c.MsgCh <- Message{Text: text, Notice: true}
+		}
+	}
+}
+
+// NewPuzzle makes the puzzle for the game's team, mission and variants
+func (g *Game) NewPuzzle() Puzzle {
+	// Only the original game plays the textbook puzzle, other scenarios
+	// deal files of their own sizes and secrecy
+	p := TextbookPuzzle(g.Rand, g.Scenario)
+	if g.Mission != nil || g.Scenario.Name != BASE_SCENARIO || len(g.Clients) != len(p.Capacities) {
+		p = GeneratePuzzle(g.Rand, g.Scenario, len(g.Clients), g.Difficulty)
+	}
+	if g.Variants[ACCESS_LOG_VARIANT] {
+		p.AddResource(g.Rand, ACCESS_LOG, 5, g.Scenario.Share(g.Difficulty))
+	}
+	if g.Variants[LINKED_FILES_VARIANT] {
+		p.AddConstraints(g.Rand, 1+g.Difficulty)
+	}
+	if g.Variants[CLEARANCE_VARIANT] {
+		p.AddClearances(g.Rand, g.Scenario.Departments, g.Difficulty)
+	}
+	return p
+}
+
+func (g *Game) LoadFiles() error {
+	// Rival teams all play the building's puzzle
+	if g.Building != nil {
+		g.Puzzle = g.Building.Puzzle
+	} else {
+		g.Puzzle = g.NewPuzzle()
 	}
+	files := g.Puzzle.Files
+
+	// Sort before shuffling so the seed alone decides who gets what
+	clients := g.SortedClients()
+	g.Rand.Shuffle(len(clients), func(i, j int) {
+		clients[i], clients[j] = clients[j], clients[i]
+	})
+
+	for i, f := range files {
+		c := clients[i%len(clients)]
+		c.Files = append(c.Files, f)
+	}
+
+	for i, c := range clients {
+		c.Bandwidth = g.Puzzle.Capacities[i]
+		if len(g.Puzzle.Budgets) > i {
+			c.Budgets = append([]int(nil), g.Puzzle.Budgets[i]...)
+		}
+		if len(g.Puzzle.Clearances) > i {
+			c.Clearances = g.Puzzle.Clearances[i]
+		}
+		if g.Variants[HANDOFF_VARIANT] {
+			c.Handoffs = HANDOFFS[g.Difficulty]
+		}
+	}
+	// Solved from the dealt hands, hand-offs depend on who holds what
+	g.Par = g.HintSolution().Score
 	return nil
 }
 
-func GenerateFiles() []File {
+// GenerateFiles deals the textbook files, named after the first 14 of
+// names at most
+func GenerateFiles(rng *rand.Rand, names []string) []File {
 	files := make([]File, 0)
-	filenames := []string{"top_secret.txt", "contacts.csv", "banknotes.dat", "cats.png", "notes_201501105.md", "secrets.ppt",
-		"jokes.txt", "pie_graph.png", "bar_chart.xcl", "peer_review_hilarious.txt", "instant_soup.txt", "dilbert_comics.jpg",
-		"screenshots.jpg", "logo.png"}
-	ShuffleStrings(filenames)
+	if len(names) > 14 {
+		names = names[:14]
+	}
+	filenames := make([]string, len(names))
+	copy(filenames, names)
+	ShuffleStrings(filenames, rng)
 	weights := []int{23, 31, 29, 44, 53, 38, 63, 85, 89, 82}
 	profits := []int{92, 57, 49, 68, 60, 43, 67, 84, 86, 72}
 
@@ -328,12 +697,34 @@ func GenerateFiles() []File {
 	return files
 }
 
-func ShuffleStrings(slc []string) {
-	rand.Seed(time.Now().UnixNano())
+func ShuffleStrings(slc []string, rng *rand.Rand) {
 	for i := 1; i < len(slc); i++ {
-		r := rand.Intn(i + 1)
+		r := rng.Intn(i + 1)
 		if i != r {
 			slc[r], slc[i] = slc[i], slc[r]
 		}
 	}
 }
+
+// NewRand returns a random source seeded with seed that is safe to share
+// between a game's goroutines
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
+
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoin(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+
+	p := s.Connect()
+	p.Run([]Step{
+		{Expect: []string{Tr(INTRO_MSG), Tr(ROOM_MSG)}},
+		{Send: "not a room!", Expect: []string{"Invalid channel", Tr(ROOM_MSG)}},
+		{Send: room, Expect: []string{Tr(NICK_MSG)}},
+		{Send: "Glenda", Expect: []string{"Invalid Username", Tr(NICK_MSG)}},
+		{Send: "alice", Expect: []string{"alice has joined " + room}},
+	})
+
+	bob := s.Join(room, "bob")
+	p.Expect("bob has joined")
+	bob.Expect("bob has joined")
+
+	carol := s.Join(room, "carol")
+	for _, player := range []*TestPlayer{p, bob, carol} {
+		player.Expect("carol has joined")
+		player.Expect("mission starting")
+	}
+}
+
+func TestFullRoom(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	for i := 0; i < MAX_NUM_CLIENTS; i++ {
+		s.Join(room, fmt.Sprintf("agent%d", i)).Expect("has joined")
+	}
+
+	late := s.Connect()
+	late.Expect(Tr(ROOM_MSG))
+	late.Send(room)
+	late.Expect(Tr(FULL_MSG))
+	late.ExpectClosed()
+}
+
+func TestNameTaken(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	s.Join(room, "alice").Expect("alice has joined")
+
+	twin := s.Join(room, "alice")
+	twin.Expect("Error name taken")
+	twin.ExpectClosed()
+}
+
+func TestCommands(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+	alice, bob := players[0], players[1]
+
+	alice.Run([]Step{
+		{Send: "/help", Expect: []string{"help -- |  Usage:", "/msg [to] [text]"}},
+		{Send: "/look", Expect: []string{"look -- | You look around", "look -- | Glenda"}},
+		{Send: "/bogus", Expect: []string{"err -- | Invalid command"}},
+		{Send: "/msg bob psst", Expect: nil},
+		{Send: "/msg nobody psst", Expect: []string{`err -- | Client "nobody" does not exist`}},
+	})
+	bob.Expect("alice | psst")
+}
+
+func TestTransfer(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+	alice, bob := players[0], players[1]
+
+	_, files := alice.List()
+	if len(files) == 0 {
+		t.Fatalf("alice has no files")
+	}
+	file := files[0]
+
+	alice.Run([]Step{
+		{Send: "/send bob " + file.Filename, Expect: []string{"send -- | Sent file: " + file.Filename}},
+		{Send: "/send bob " + file.Filename, Expect: []string{`err -- | Error sending file: file "` + file.Filename + `" does not exist`}},
+		{Send: "/send nobody " + files[len(files)-1].Filename, Expect: []string{`client "nobody" does not exist`}},
+	})
+	bob.Expect("send -- | Received file: " + file.Filename)
+
+	bandwidth, held := bob.List()
+	found := false
+	for _, f := range held {
+		found = found || f.Filename == file.Filename
+	}
+	if !found {
+		t.Fatalf("Expected %s in bob's files %#v", file.Filename, held)
+	}
+
+	score := 0
+	if file.Size <= bandwidth {
+		bob.Send("/send Glenda " + file.Filename)
+		bob.Expect("send -- | Sent file: " + file.Filename)
+		score = file.Secrecy
+	}
+	for _, p := range players {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range players {
+		p.Expect(fmt.Sprintf("Game ended. Score %d", score))
+		p.ExpectClosed()
+	}
+}
+
+func TestBandwidthExceeded(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+
+	// Pile every file onto alice, more than anyone can send
+	for _, p := range players[1:] {
+		_, files := p.List()
+		for _, f := range files {
+			p.Send("/send alice " + f.Filename)
+			p.Expect("Sent file: " + f.Filename)
+		}
+	}
+	alice := players[0]
+	bandwidth, files := alice.List()
+	for _, f := range files {
+		alice.Send("/send Glenda " + f.Filename)
+		bandwidth -= f.Size
+		if bandwidth < 0 {
+			break
+		}
+		alice.Expect("Sent file: " + f.Filename)
+	}
+	if bandwidth >= 0 {
+		t.Fatalf("Expected alice to run out of bandwidth")
+	}
+
+	for _, p := range players {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range players {
+		p.Expect(Tr(FAIL_MSG))
+		p.ExpectClosed()
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+
+	s.Clock.Advance(MISSION_DURATIONS[NORMAL] + time.Second)
+	for _, p := range players {
+		p.Expect(Tr(FAIL_MSG))
+		p.ExpectClosed()
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+
+	players[0].Close()
+	for _, p := range players[1:] {
+		p.Expect("alice has left")
+		p.Expect(Tr(LEFT_MSG))
+		p.ExpectClosed()
+	}
+}
+
+func TestAccessLogVariant(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Expect("alice has joined")
+	alice.Send("/mode accesslog")
+	alice.Expect("alice turned on accesslog")
+
+	bob := s.Join(room, "bob")
+	bob.Run([]Step{
+		{Send: "/mode accesslog off", Expect: []string{"err -- | Only alice can change the game variants"}},
+	})
+	s.Join(room, "carol")
+	alice.Expect("mission starting")
+
+	alice.Run([]Step{
+		{Send: "/list", Expect: []string{"list -- | Remaining Access Log:", "Access Log"}},
+		{Send: "/status", Expect: []string{"Access Log"}},
+	})
+}
+
+func TestLinkedFilesVariant(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Expect("alice has joined")
+	alice.Send("/mode linked")
+	alice.Expect("alice turned on linked")
+	s.Join(room, "bob")
+	s.Join(room, "carol")
+	alice.Expect("mission starting")
+
+	alice.Run([]Step{
+		{Send: "/list", Expect: []string{"only worth anything together", "will alert security"}},
+	})
+}
+
+func TestClearanceVariant(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	players := []*TestPlayer{s.Join(room, "alice")}
+	players[0].Expect("alice has joined")
+	players[0].Send("/mode clearance")
+	players[0].Expect("alice turned on clearance")
+	players = append(players, s.Join(room, "bob"), s.Join(room, "carol"))
+	players[0].Expect("mission starting")
+
+	fileRe := regexp.MustCompile(`^list -- \|\s+(\S+)\s+\d+ KB\s+\d+\s+(\S+)$`)
+	for _, p := range players {
+		clearances := ""
+		for _, line := range p.Command("/list") {
+			if strings.HasPrefix(line, "list -- | Your clearance: ") {
+				clearances = line
+			}
+			m := fileRe.FindStringSubmatch(line)
+			if m == nil || m[1] == "Filename" || strings.Contains(clearances, m[2]) {
+				continue
+			}
+			p.Send("/send Glenda " + m[1])
+			p.Expect(fmt.Sprintf("err -- | You don't have %s clearance for %s", m[2], m[1]))
+			return
+		}
+	}
+	t.Fatalf("Expected someone to hold a file they aren't cleared for")
+}
+
+func TestHandoffVariant(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Expect("alice has joined")
+	alice.Send("/mode handoffs")
+	alice.Expect("alice turned on handoffs")
+	bob := s.Join(room, "bob")
+	s.Join(room, "carol")
+	alice.Expect("mission starting")
+
+	_, files := alice.List()
+	limit := HANDOFFS[NORMAL]
+	for i := 0; i < limit; i++ {
+		alice.Run([]Step{
+			{Send: "/send bob " + files[i].Filename, Expect: []string{fmt.Sprintf("send -- | Hand-offs remaining: %d", limit-i-1)}},
+		})
+	}
+	last := files[0]
+	if len(files) > limit {
+		last = files[limit]
+	} else {
+		bob.Expect("Received file: " + last.Filename)
+		bob.Send("/send alice " + last.Filename)
+		alice.Expect("Received file: " + last.Filename)
+	}
+	alice.Run([]Step{
+		{Send: "/send carol " + last.Filename, Expect: []string{"err -- | You're out of hand-offs"}},
+		{Send: "/status", Expect: []string{"Hand-offs"}},
+	})
+}
+
+func TestVersus(t *testing.T) {
+	s := NewTestServer(t)
+	red, blue := s.Room(), s.Room()
+	alice := s.Join(red, "alice")
+	alice.Expect("alice has joined")
+	dave := s.Join(blue, "dave")
+	dave.Expect("dave has joined")
+
+	alice.Run([]Step{{Send: "/versus " + blue, Expect: []string{"alice challenged team " + blue}}})
+	dave.Run([]Step{
+		{Send: "/versus", Expect: []string{"Team " + red + " challenged you"}},
+		{Send: "/versus " + red, Expect: []string{"are rivals"}},
+	})
+	alice.Expect("are rivals")
+
+	players := []*TestPlayer{alice, s.Join(red, "bob"), s.Join(red, "carol"), dave, s.Join(blue, "erin"), s.Join(blue, "frank")}
+	for _, p := range players {
+		p.Expect("mission starting")
+	}
+
+	bandwidth, files := alice.List()
+	file := files[0]
+	for _, f := range files {
+		if f.Size < file.Size {
+			file = f
+		}
+	}
+	if file.Size > bandwidth {
+		t.Fatalf("alice can't send any of her files")
+	}
+	alice.Run([]Step{{Send: "/send Glenda " + file.Filename, Expect: []string{"Sent file: " + file.Filename}}})
+	for _, p := range players[3:] {
+		p.Expect(fmt.Sprintf("Team %s got %s to Glenda first", red, file.Filename))
+	}
+
+	for _, p := range players {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range players {
+		p.Expect("versus -- | Results:")
+		p.Expect("1. " + red)
+		p.ExpectClosed()
+	}
+}
+
+func TestVersusRules(t *testing.T) {
+	s := NewTestServer(t)
+	red, blue := s.Room(), s.Room()
+	alice := s.Join(red, "alice")
+	alice.Expect("alice has joined")
+	dave := s.Join(blue, "dave")
+	dave.Expect("dave has joined")
+
+	alice.Run([]Step{
+		{Send: "/difficulty hard", Expect: []string{"alice set the difficulty to hard"}},
+		{Send: "/versus " + blue, Expect: []string{"alice challenged team " + blue}},
+	})
+	dave.Run([]Step{{Send: "/versus " + red, Expect: []string{"err -- | Team " + red + " plays on hard, you play on normal"}}})
+
+	dave.Run([]Step{{Send: "/difficulty hard", Expect: []string{"dave set the difficulty to hard"}}})
+	alice.Run([]Step{{Send: "/versus " + blue, Expect: []string{"alice challenged team " + blue}}})
+	dave.Run([]Step{{Send: "/versus " + red, Expect: []string{"are rivals"}}})
+	alice.Run([]Step{
+		{Expect: []string{"are rivals"}},
+		{Send: "/mode linked", Expect: []string{"err -- | Rival teams play by the same rules"}},
+		{Send: "/difficulty easy", Expect: []string{"err -- | Rival teams play by the same rules"}},
+	})
+}
+
+func TestVersusChallengeEnds(t *testing.T) {
+	s := NewTestServer(t)
+	red, blue := s.Room(), s.Room()
+	alice := s.Join(red, "alice")
+	alice.Expect("alice has joined")
+	bob := s.Join(red, "bob")
+	bob.Expect("bob has joined")
+	alice.Run([]Step{{Send: "/versus " + blue, Expect: []string{"alice challenged team " + blue}}})
+
+	// Once the challenger's game is over, its challenge is gone
+	alice.Close()
+	bob.ExpectClosed()
+	dave := s.Join(blue, "dave")
+	dave.Expect("dave has joined")
+	dave.Run([]Step{{Send: "/versus " + red, Expect: []string{"dave challenged team " + red}}})
+}
+
+func TestQuickPlay(t *testing.T) {
+	s := NewTestServer(t)
+	players := make([]*TestPlayer, 0)
+	for _, name := range []string{"quinn", "rosa", "sam"} {
+		p := s.Connect()
+		p.Name = name
+		p.Expect(Tr(ROOM_MSG))
+		p.Send(QUICK_PLAY)
+		p.Expect(Tr(NICK_MSG))
+		p.Send(name)
+		p.Expect("Looking for teammates")
+		players = append(players, p)
+	}
+	for _, p := range players {
+		p.Expect("sam has joined " + QUICK_PLAY + "-")
+		p.Expect("mission starting")
+	}
+}
+
+func TestAITeammates(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Expect("alice has joined")
+	bob := s.Join(room, "bob")
+	bob.Expect("bob has joined")
+
+	bob.Run([]Step{{Send: "/ai", Expect: []string{"Only alice can bring in AI agents"}}})
+	alice.Run([]Step{{Send: "/ai", Expect: []string{"alice brought in agent " + AI_NAMES[0], "mission starting"}}})
+	bob.Expect("mission starting")
+
+	bob.Run([]Step{{Send: "/msg " + AI_NAMES[0] + " what do you have?", Expect: []string{AI_NAMES[0] + " | I have"}}})
+	alice.Send("/msg Glenda done")
+	bob.Send("/msg Glenda done")
+	for _, p := range []*TestPlayer{alice, bob} {
+		p.Expect("Game ended. Score")
+		p.ExpectClosed()
+	}
+	if p, _ := s.Stores.Profiles.Get("alice"); p.Teammates[AI_NAMES[0]] != 0 || p.Teammates["bob"] != 1 {
+		t.Errorf("Expected only bob among alice's teammates, got %v", p.Teammates)
+	}
+}
+
+func TestAIFill(t *testing.T) {
+	LobbyFillWait = time.Minute
+	defer func() { LobbyFillWait = 0 }()
+	s := NewTestServer(t)
+	alice := s.Join(s.Room(), "alice")
+	alice.Expect("alice has joined")
+	s.Clock.Advance(LobbyFillWait)
+	alice.Run([]Step{{Expect: []string{"the server sent agent " + AI_NAMES[0], "the server sent agent " + AI_NAMES[1], "mission starting"}}})
+	alice.Send("/msg Glenda done")
+	line := alice.Expect("Game ended. Score")
+	if strings.HasPrefix(line, "Game ended. Score 0") {
+		t.Errorf("Expected the AI agents to send Glenda something, got %q", line)
+	}
+}
+
+func TestLobbyTimeout(t *testing.T) {
+	s := NewTestServer(t)
+	alice := s.Join(s.Room(), "alice")
+	alice.Expect("alice has joined")
+	s.Clock.Advance(LOBBY_TIMEOUT)
+	alice.Expect(Tr(LOBBY_MSG))
+	alice.ExpectClosed()
+}
+
+func TestHints(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carol")
+	alice := players[0]
+	for left := MAX_HINTS - 1; left >= 0; left-- {
+		alice.Run([]Step{{Send: "/hint", Expect: []string{fmt.Sprintf("alice asked for a hint (-%d points, %d left)", HINT_PENALTY, left)}}})
+	}
+	alice.Run([]Step{{Send: "/hint", Expect: []string{"Glenda shrugs"}}})
+
+	// Hints never take the score below 0
+	for _, p := range players {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range players {
+		p.Expect(fmt.Sprintf("Game ended. Score 0 (0 - %d for %d hints)", MAX_HINTS*HINT_PENALTY, MAX_HINTS))
+	}
+}
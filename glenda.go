@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Default script, writers can extend it by pointing GLENDA_DIALOGUE at
+// another JSON file with the same layout as dialogue/glenda.json
+
+//go:embed dialogue/glenda.json
+var defaultDialogue []byte
+
+var GlendaDialogue *Dialogue = MustLoadDialogue()
+
+// Translations of the default script, dialogue/glenda.[lang].json. Intents
+// and reactions a translation leaves out stay in English.
+
+//go:embed dialogue/glenda.*.json
+var localizedDialogues embed.FS
+
+var GlendaDialogues map[string]*Dialogue = MustLoadLocalizedDialogues()
+
+func MustLoadLocalizedDialogues() map[string]*Dialogue {
+	dialogues := make(map[string]*Dialogue)
+	entries, err := localizedDialogues.ReadDir("dialogue")
+	if err != nil {
+		panic(fmt.Sprintf("invalid dialogue translations: %s", err.Error()))
+	}
+	for _, entry := range entries {
+		lang := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), "glenda."), ".json")
+		data, err := localizedDialogues.ReadFile("dialogue/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("invalid dialogue %s: %s", entry.Name(), err.Error()))
+		}
+		d, err := ParseDialogue(defaultDialogue)
+		if err != nil {
+			panic(fmt.Sprintf("invalid default dialogue: %s", err.Error()))
+		}
+		translation, err := ParseDialogue(data)
+		if err != nil {
+			panic(fmt.Sprintf("invalid dialogue %s: %s", entry.Name(), err.Error()))
+		}
+		d.Merge(translation)
+		dialogues[lang] = d
+	}
+	return dialogues
+}
+
+// GlendaFor is the script Glenda uses with c. Games on their scenario's
+// script speak the player's language if there is a translation.
+func (g *Game) GlendaFor(c *Client) *Dialogue {
+	if g.Glenda == g.Scenario.Dialogue {
+		if d, ok := g.Scenario.Dialogues[c.Catalog().Lang]; ok {
+			return d
+		}
+	}
+	return g.Glenda
+}
+
+const (
+	LOW_TIME_EVENT     = "low_time"
+	BIG_TRANSFER_EVENT = "big_transfer"
+)
+
+type Intent struct {
+	Name      string   `json:"name"`
+	Keywords  []string `json:"keywords"`
+	Responses []string `json:"responses"`
+}
+
+type Reaction struct {
+	Event     string   `json:"event"`
+	Threshold int      `json:"threshold"`
+	Responses []string `json:"responses"`
+}
+
+type Dialogue struct {
+	NPC       string     `json:"npc"`
+	Fallback  []string   `json:"fallback"`
+	Intents   []Intent   `json:"intents"`
+	Reactions []Reaction `json:"reactions"`
+
+	templates map[string]*template.Template
+}
+
+// Values available to the templates in a dialogue script
+type DialogueContext struct {
+	Name      string
+	Bandwidth int
+	Files     int
+	Score     int
+	TimeLeft  int
+	Done      int
+	Team      int
+	File      File
+}
+
+func MustLoadDialogue() *Dialogue {
+	d, err := ParseDialogue(defaultDialogue)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default dialogue: %s", err.Error()))
+	}
+
+	path := os.Getenv("GLENDA_DIALOGUE")
+	if path == "" {
+		return d
+	}
+	extra, err := LoadDialogue(path)
+	if err != nil {
+		log.Printf("Error loading dialogue %s, using default: %s", path, err.Error())
+		return d
+	}
+	d.Merge(extra)
+	return d
+}
+
+func LoadDialogue(path string) (*Dialogue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDialogue(data)
+}
+
+func ParseDialogue(data []byte) (*Dialogue, error) {
+	d := &Dialogue{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	if err := d.compile(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Merge adds the intents and reactions of other to d. Intents and reactions
+// with the same name or event replace the existing ones.
+func (d *Dialogue) Merge(other *Dialogue) {
+	if other.NPC != "" {
+		d.NPC = other.NPC
+	}
+	if len(other.Fallback) > 0 {
+		d.Fallback = other.Fallback
+	}
+outerIntents:
+	for _, in := range other.Intents {
+		for i := range d.Intents {
+			if d.Intents[i].Name == in.Name {
+				d.Intents[i] = in
+				continue outerIntents
+			}
+		}
+		d.Intents = append(d.Intents, in)
+	}
+outerReactions:
+	for _, r := range other.Reactions {
+		for i := range d.Reactions {
+			if d.Reactions[i].Event == r.Event {
+				d.Reactions[i] = r
+				continue outerReactions
+			}
+		}
+		d.Reactions = append(d.Reactions, r)
+	}
+	for k, t := range other.templates {
+		d.templates[k] = t
+	}
+}
+
+func (d *Dialogue) compile() error {
+	d.templates = make(map[string]*template.Template)
+	add := func(text string) error {
+		if _, ok := d.templates[text]; ok {
+			return nil
+		}
+		t, err := template.New("").Parse(text)
+		if err != nil {
+			return err
+		}
+		d.templates[text] = t
+		return nil
+	}
+
+	for _, text := range d.Fallback {
+		if err := add(text); err != nil {
+			return err
+		}
+	}
+	for _, in := range d.Intents {
+		for _, text := range in.Responses {
+			if err := add(text); err != nil {
+				return fmt.Errorf("intent %s: %s", in.Name, err.Error())
+			}
+		}
+	}
+	for _, r := range d.Reactions {
+		for _, text := range r.Responses {
+			if err := add(text); err != nil {
+				return fmt.Errorf("reaction %s: %s", r.Event, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the intent whose keywords best match text, or nil
+func (d *Dialogue) Match(text string) *Intent {
+	padded := " " + normalize(text) + " "
+	var best *Intent
+	bestScore := 0
+	for i, in := range d.Intents {
+		score := 0
+		for _, kw := range in.Keywords {
+			kw = normalize(kw)
+			if kw != "" && strings.Contains(padded, " "+kw+" ") {
+				// Longer phrases are more specific than single words
+				score += len(strings.Fields(kw))
+			}
+		}
+		if score > bestScore {
+			best = &d.Intents[i]
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// Respond returns Glenda's reply to text, formatted for the player
+func (d *Dialogue) Respond(text string, ctx DialogueContext, rng *rand.Rand) string {
+	reply := ""
+	if r := d.Reaction(LOW_TIME_EVENT); r != nil && ctx.TimeLeft <= r.Threshold {
+		reply += d.render(r.Responses, ctx, rng)
+	}
+	if in := d.Match(text); in != nil {
+		return reply + d.render(in.Responses, ctx, rng)
+	}
+	return reply + d.render(d.Fallback, ctx, rng)
+}
+
+// React returns Glenda's line for event, or "" if the script has none
+func (d *Dialogue) React(event string, ctx DialogueContext, rng *rand.Rand) string {
+	r := d.Reaction(event)
+	if r == nil {
+		return ""
+	}
+	return d.render(r.Responses, ctx, rng)
+}
+
+func (d *Dialogue) Reaction(event string) *Reaction {
+	for i, r := range d.Reactions {
+		if r.Event == event {
+			return &d.Reactions[i]
+		}
+	}
+	return nil
+}
+
+func (d *Dialogue) render(responses []string, ctx DialogueContext, rng *rand.Rand) string {
+	if len(responses) == 0 {
+		return ""
+	}
+	text := responses[rng.Intn(len(responses))]
+
+	var buf bytes.Buffer
+	if err := d.templates[text].Execute(&buf, ctx); err != nil {
+		log.Printf("Error rendering dialogue: %s", err.Error())
+		return ""
+	}
+
+	// A response ending in a newline doesn't get an empty line
+	out := ""
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		out += fmt.Sprintf("%s | %s\n", d.NPC, line)
+	}
+	return out
+}
+
+func normalize(text string) string {
+	text = strings.ToLower(text)
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' {
+			return r
+		}
+		return ' '
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+const testDialogue = `{
+	"npc": "Glenda",
+	"fallback": ["Come again?"],
+	"intents": [
+		{"name": "greeting", "keywords": ["hi", "hello"], "responses": ["Hey {{.Name}}."]},
+		{"name": "bandwidth", "keywords": ["bandwidth", "how much can i send"], "responses": ["{{.Bandwidth}} KB left.\n"]},
+		{"name": "time", "keywords": ["time", "how long"], "responses": ["{{.TimeLeft}} seconds.\nHurry."]}
+	],
+	"reactions": [
+		{"event": "low_time", "threshold": 10, "responses": ["Quick!"]}
+	]
+}`
+
+func TestDialogueMatch(t *testing.T) {
+	d, err := ParseDialogue([]byte(testDialogue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Text   string
+		Intent string
+	}{
+		{"Hi Glenda!", "greeting"},
+		{"HELLO", "greeting"},
+		{"this", ""},
+		{"hi, how much can I send?", "bandwidth"},
+		{"hi, how long", "time"},
+		{"bandwidths", ""},
+	}
+	for _, test := range tests {
+		name := ""
+		if in := d.Match(test.Text); in != nil {
+			name = in.Name
+		}
+		if name != test.Intent {
+			t.Errorf("%q: expected intent %q, got %q", test.Text, test.Intent, name)
+		}
+	}
+}
+
+func TestDialogueRespond(t *testing.T) {
+	d, err := ParseDialogue([]byte(testDialogue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := DialogueContext{Name: "alice", Bandwidth: 42, TimeLeft: 60}
+	tests := []struct {
+		Text     string
+		TimeLeft int
+		Reply    string
+	}{
+		{"hello", 60, "Glenda | Hey alice.\n"},
+		{"bandwidth?", 60, "Glenda | 42 KB left.\n"},
+		{"time", 60, "Glenda | 60 seconds.\nGlenda | Hurry.\n"},
+		{"what", 60, "Glenda | Come again?\n"},
+		{"hi", 5, "Glenda | Quick!\nGlenda | Hey alice.\n"},
+	}
+	for _, test := range tests {
+		ctx.TimeLeft = test.TimeLeft
+		if reply := d.Respond(test.Text, ctx, NewRand(1)); reply != test.Reply {
+			t.Errorf("%q: expected %q, got %q", test.Text, test.Reply, reply)
+		}
+	}
+	if reply := d.React(BIG_TRANSFER_EVENT, ctx, NewRand(1)); reply != "" {
+		t.Errorf("Expected no line for an event without a reaction, got %q", reply)
+	}
+}
+
+func TestDialogueMerge(t *testing.T) {
+	d, err := ParseDialogue([]byte(testDialogue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := ParseDialogue([]byte(`{
+		"npc": "Juno",
+		"intents": [
+			{"name": "greeting", "keywords": ["hola"], "responses": ["Hola {{.Name}}."]},
+			{"name": "score", "keywords": ["score"], "responses": ["{{.Score}} so far."]}
+		],
+		"reactions": [{"event": "big_transfer", "threshold": 50, "responses": ["Nice."]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Merge(extra)
+
+	ctx := DialogueContext{Name: "alice", Score: 7, TimeLeft: 60}
+	tests := []struct {
+		Text  string
+		Reply string
+	}{
+		{"hola", "Juno | Hola alice.\n"},
+		// The greeting was replaced, keywords and all
+		{"hi", "Juno | Come again?\n"},
+		{"score", "Juno | 7 so far.\n"},
+		{"bandwidth", "Juno | 0 KB left.\n"},
+	}
+	for _, test := range tests {
+		if reply := d.Respond(test.Text, ctx, NewRand(1)); reply != test.Reply {
+			t.Errorf("%q: expected %q, got %q", test.Text, test.Reply, reply)
+		}
+	}
+	if reply := d.React(BIG_TRANSFER_EVENT, ctx, NewRand(1)); reply != "Juno | Nice.\n" {
+		t.Errorf("Expected the merged reaction, got %q", reply)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// How long a player waits for an expected line before the test fails
+const EXPECT_TIMEOUT = 2 * time.Second
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "goph3r")
+	if err != nil {
+		panic(err)
+	}
+	Campaigns = NewCampaignStore(filepath.Join(dir, "campaign.json"))
+	Accounts = NewAccountStore(filepath.Join(dir, "accounts.json"))
+	Profiles = NewProfileStore(filepath.Join(dir, "profiles.json"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Seed for the puzzles in every test server
+const TEST_SEED int64 = 1
+
+// TestServer runs the connection and game handlers in process, players
+// connect to it over net.Pipe. Its games run on a fake clock that only moves
+// when a test advances it. Accounts and profiles are kept apart from every
+// other test server's, so a test can run more than once.
+type TestServer struct {
+	t      *testing.T
+	Clock  *FakeClock
+	Stores Stores
+	connCh chan net.Conn
+}
+
+// Rooms handed out so far, so no two tests share one
+var testRooms int64
+
+func NewTestServer(t *testing.T) *TestServer {
+	connCh := make(chan net.Conn, 10)
+	gameRequestCh := make(chan GameRequest, 10)
+	clock := NewFakeClock(time.Date(2015, 7, 8, 9, 0, 0, 0, time.UTC))
+	dir, err := ioutil.TempDir("", "goph3r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	stores := DefaultStores()
+	stores.Accounts = NewAccountStore(filepath.Join(dir, "accounts.json"))
+	stores.Profiles = NewProfileStore(filepath.Join(dir, "profiles.json"))
+	go ConnectionHandler(connCh, gameRequestCh, stores)
+	go GameHandler(gameRequestCh, clock, TEST_SEED, stores)
+	return &TestServer{t: t, Clock: clock, Stores: stores, connCh: connCh}
+}
+
+// Room returns a room name no other test has used
+func (s *TestServer) Room() string {
+	n := atomic.AddInt64(&testRooms, 1)
+	return fmt.Sprintf("%s%d", regexp.MustCompile(`\W`).ReplaceAllString(s.t.Name(), ""), n)
+}
+
+func (s *TestServer) Connect() *TestPlayer {
+	client, server := net.Pipe()
+	s.connCh <- server
+	p := &TestPlayer{t: s.t, conn: client, lines: make(chan string, 100)}
+	go p.read()
+	return p
+}
+
+// Join connects a player and answers the room and nickname prompts
+func (s *TestServer) Join(room string, name string) *TestPlayer {
+	p := s.Connect()
+	p.Name = name
+	p.Expect(Tr(ROOM_MSG))
+	p.Send(room)
+	p.Expect(Tr(NICK_MSG))
+	p.Send(name)
+	return p
+}
+
+// StartGame joins a full team to a new room and waits for the mission to
+// start
+func (s *TestServer) StartGame(names ...string) []*TestPlayer {
+	room := s.Room()
+	players := make([]*TestPlayer, len(names))
+	for i, name := range names {
+		players[i] = s.Join(room, name)
+		players[i].Expect(fmt.Sprintf("%s has joined", name))
+	}
+	for _, p := range players {
+		p.Expect("mission starting")
+	}
+	return players
+}
+
+type TestPlayer struct {
+	t     *testing.T
+	Name  string
+	conn  net.Conn
+	lines chan string
+}
+
+// A Step sends a line and then expects lines containing each of Expect, in
+// order, skipping anything in between
+type Step struct {
+	Send   string
+	Expect []string
+}
+
+func (p *TestPlayer) read() {
+	defer close(p.lines)
+	buf := make([]byte, 0)
+	chunk := make([]byte, 1024)
+	for {
+		n, err := p.conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		for {
+			i := strings.IndexByte(string(buf), '\n')
+			if i < 0 {
+				break
+			}
+			p.lines <- string(buf[:i])
+			buf = buf[i+1:]
+		}
+		if err != nil {
+			if len(buf) > 0 {
+				p.lines <- string(buf)
+			}
+			return
+		}
+	}
+}
+
+func (p *TestPlayer) Send(text string) {
+	p.t.Helper()
+	if _, err := io.WriteString(p.conn, text+"\n"); err != nil {
+		p.t.Fatalf("%s: error sending %q: %s", p.Name, text, err.Error())
+	}
+}
+
+// Expect reads lines until one contains text and returns it. Multi-line
+// text only has to match its first line.
+func (p *TestPlayer) Expect(text string) string {
+	p.t.Helper()
+	text = strings.SplitN(text, "\n", 2)[0]
+	timeout := time.After(EXPECT_TIMEOUT)
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				p.t.Fatalf("%s: connection closed waiting for %q", p.Name, text)
+			}
+			if strings.Contains(line, text) {
+				return line
+			}
+		case <-timeout:
+			p.t.Fatalf("%s: timed out waiting for %q", p.Name, text)
+		}
+	}
+}
+
+// ExpectClosed reads until the server closes the connection
+func (p *TestPlayer) ExpectClosed() {
+	p.t.Helper()
+	timeout := time.After(EXPECT_TIMEOUT)
+	for {
+		select {
+		case _, ok := <-p.lines:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			p.t.Fatalf("%s: timed out waiting for the connection to close", p.Name)
+		}
+	}
+}
+
+func (p *TestPlayer) Run(script []Step) {
+	p.t.Helper()
+	for _, step := range script {
+		if step.Send != "" {
+			p.Send(step.Send)
+		}
+		for _, text := range step.Expect {
+			p.Expect(text)
+		}
+	}
+}
+
+// Command sends cmd and returns every line written back before a message
+// the player sends itself right after it
+func (p *TestPlayer) Command(cmd string) []string {
+	p.t.Helper()
+	marker := fmt.Sprintf("%s | end of %s", p.Name, cmd)
+	p.Send(cmd)
+	p.Send(fmt.Sprintf("/msg %s end of %s", p.Name, cmd))
+
+	lines := make([]string, 0)
+	timeout := time.After(EXPECT_TIMEOUT)
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				p.t.Fatalf("%s: connection closed during %q", p.Name, cmd)
+			}
+			if line == marker {
+				return lines
+			}
+			lines = append(lines, line)
+		case <-timeout:
+			p.t.Fatalf("%s: timed out during %q", p.Name, cmd)
+		}
+	}
+}
+
+var listFileRe = regexp.MustCompile(`^list -- \|\s+(\S+)\s+(\d+) KB\s+(\d+)$`)
+var listBandwidthRe = regexp.MustCompile(`^list -- \| Remaining Bandwidth: (-?\d+) KB$`)
+
+// List runs /list and parses the player's bandwidth and files
+func (p *TestPlayer) List() (int, []File) {
+	p.t.Helper()
+	bandwidth := 0
+	files := make([]File, 0)
+	for _, line := range p.Command("/list") {
+		if m := listBandwidthRe.FindStringSubmatch(line); m != nil {
+			bandwidth, _ = strconv.Atoi(m[1])
+		}
+		if m := listFileRe.FindStringSubmatch(line); m != nil {
+			size, _ := strconv.Atoi(m[2])
+			secrecy, _ := strconv.Atoi(m[3])
+			files = append(files, File{Filename: m[1], Size: size, Secrecy: secrecy})
+		}
+	}
+	return bandwidth, files
+}
+
+func (p *TestPlayer) Close() {
+	p.conn.Close()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+)
+
+const MAX_HINTS int = 3
+
+// Secrecy points taken off the final score for every hint used
+const HINT_PENALTY int = 15
+
+const NO_HINTS_MSG string = "hint.none_left"
+
+// Hint spends one of the game's hints. Each hint is more specific than the
+// last: first which agent is over-filled, then which file to move, and
+// finally which file to send to Glenda.
+func (c *Client) Hint() {
+	g := c.Game
+	if g.HintsUsed >= MAX_HINTS {
+		c.Tell(NO_HINTS_MSG)
+		return
+	}
+	g.HintsUsed++
+	level := g.HintsUsed
+
+	var text Text
+	switch level {
+	case 1:
+		text = g.OverfillHint()
+	case 2:
+		text = g.MoveHint()
+	default:
+		text = g.SendHint(c)
+	}
+	left := MAX_HINTS - g.HintsUsed
+	g.MsgAll("hint.asked", c.Name, HINT_PENALTY, left)
+	c.Tell("hint.text", text)
+}
+
+// HintSolution solves the game from its current state
+func (g *Game) HintSolution() Solution {
+	v := g.View()
+	return v.Solution()
+}
+
+// Forbidden reports whether sending filename would conflict with a file
+// Glenda already has
+func (g *Game) Forbidden(filename string) bool {
+	for _, c := range g.Puzzle.Constraints {
+		if c.Kind == CONFLICTS && g.Received(c.Partner(filename)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) OverfillHint() Text {
+	worst := ""
+	over := 0
+	for _, c := range g.SortedClients() {
+		if c.DoneSendingFiles {
+			continue
+		}
+		size := 0
+		for _, f := range c.Files {
+			size += f.Size
+		}
+		if size-c.Bandwidth > over {
+			worst = c.Name
+			over = size - c.Bandwidth
+		}
+	}
+	if worst == "" {
+		return T("hint.no_overfill")
+	}
+	return T("hint.overfill", worst, over)
+}
+
+func (g *Game) MoveHint() Text {
+	plan := g.HintSolution().Plan
+	for _, c := range g.SortedClients() {
+		if c.DoneSendingFiles {
+			continue
+		}
+		for _, f := range c.Files {
+			owner := plan.Owner(f.Filename)
+			if owner != "" && owner != c.Name {
+				return T("hint.move", c.Name, f.Filename, owner)
+			}
+		}
+	}
+	for _, c := range g.SortedClients() {
+		for _, f := range c.Files {
+			if !c.DoneSendingFiles && plan.Owner(f.Filename) == "" {
+				return T("hint.leave", f.Filename)
+			}
+		}
+	}
+	return T("hint.all_placed")
+}
+
+func (g *Game) SendHint(c *Client) Text {
+	if c.DoneSendingFiles {
+		return T("hint.done")
+	}
+	plan := g.HintSolution().Plan
+	for _, f := range plan[c.Name] {
+		for _, held := range c.Files {
+			if held.Filename == f.Filename {
+				return T("hint.send", f.Filename)
+			}
+		}
+	}
+	if len(plan[c.Name]) > 0 {
+		return T("hint.wait", plan[c.Name][0].Filename)
+	}
+	return g.MoveHint()
+}
+
+// SortedClients returns the game's clients ordered by name so hints are
+// stable between calls
+func (g *Game) SortedClients() []*Client {
+	clients := make([]*Client, 0, len(g.Clients))
+	for _, c := range g.Clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name < clients[j].Name
+	})
+	return clients
+}
+
+// FinalScore is the secrecy Glenda received minus the hint penalties, and
+// never below 0
+func (g *Game) FinalScore() int {
+	if score := g.Score - g.HintsUsed*HINT_PENALTY; score > 0 {
+		return score
+	}
+	return 0
+}
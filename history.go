@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Messages kept for each player
+const HISTORY_SIZE int = 200
+
+// Messages /history shows when not told how many
+const HISTORY_SHOWN int = 20
+
+// HistoryEntry is a message a player was shown
+type HistoryEntry struct {
+	Time time.Time
+	From string // "" for notices from the game
+	Text string
+}
+
+// Remember keeps msg in the history of the player called name, if it is
+// chat or a notice. It is kept by name so a player who comes back to the
+// room gets theirs back.
+func (g *Game) Remember(name string, msg Message) {
+	// Notes to self, like the terminal client's queries, aren't kept
+	if msg.From == "" && !msg.Notice || msg.From == name {
+		return
+	}
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	history := append(g.History[name], HistoryEntry{Time: g.Clock.Time.Now(), From: msg.From, Text: msg.Text})
+	if len(history) > HISTORY_SIZE {
+		history = history[len(history)-HISTORY_SIZE:]
+	}
+	g.History[name] = history
+}
+
+// Remember keeps msg in c's history, once c is in a game
+func (c *Client) Remember(msg Message) {
+	if c.Game != nil {
+		c.Game.Remember(c.Name, msg)
+	}
+}
+
+// Recall returns the last n messages the player called name was shown,
+// only those from from when it isn't ""
+func (g *Game) Recall(name string, n int, from string) []HistoryEntry {
+	// No more are kept, however many are asked for
+	if n > HISTORY_SIZE {
+		n = HISTORY_SIZE
+	}
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	entries := make([]HistoryEntry, 0, n)
+	history := g.History[name]
+	for i := len(history) - 1; i >= 0 && len(entries) < n; i-- {
+		if from == "" || strings.EqualFold(history[i].From, from) {
+			entries = append(entries, history[i])
+		}
+	}
+	// Oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// ShowHistory replays the last count messages, from one agent when from is
+// set
+func (c *Client) ShowHistory(count string, from string) {
+	n := HISTORY_SHOWN
+	if count != "" {
+		// Checked to be a number by the command's arguments
+		n, _ = strconv.Atoi(count)
+	}
+	entries := c.Game.Recall(c.Name, n, from)
+	if len(entries) == 0 {
+		if from != "" {
+			c.Tell("history.none_from", from)
+		} else {
+			c.Tell("history.empty")
+		}
+		return
+	}
+	text := ""
+	for _, e := range entries {
+		stamp := e.Time.Format("15:04:05")
+		for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+			text += c.Tr("history.line", stamp, line)
+		}
+	}
+	c.MsgCh <- Message{Text: text}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var historyLineRe = regexp.MustCompile(`^history -- \| \d\d:\d\d:\d\d  (.*)$`)
+
+func TestHistory(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("alice", "bob", "carl")
+	alice, bob, carl := players[0], players[1], players[2]
+
+	bob.Send("/msg alice first")
+	alice.Expect("bob | first")
+	carl.Send("/msg alice from carl")
+	alice.Expect("carl | from carl")
+	bob.Send("/msg alice second")
+	alice.Expect("bob | second")
+	alice.Send("/msg Glenda hello")
+	alice.Expect("Glenda | ")
+
+	tests := []struct {
+		Cmd   string
+		Lines []string
+	}{
+		{"/history 3", []string{"carl | from carl", "bob | second", "Glenda | "}},
+		{"/h 5 bob", []string{"bob | first", "bob | second"}},
+		{"/history 1 BOB", []string{"bob | second"}},
+		{"/history 9223372036854775807 carl", []string{"carl | from carl"}},
+	}
+	for _, test := range tests {
+		lines := make([]string, 0)
+		for _, line := range alice.Command(test.Cmd) {
+			if m := historyLineRe.FindStringSubmatch(line); m != nil {
+				lines = append(lines, m[1])
+			}
+		}
+		if len(lines) != len(test.Lines) {
+			t.Fatalf("%s: expected %q, got %q", test.Cmd, test.Lines, lines)
+		}
+		for i, line := range lines {
+			if !strings.HasPrefix(line, test.Lines[i]) {
+				t.Errorf("%s: expected %q, got %q", test.Cmd, test.Lines[i], line)
+			}
+		}
+	}
+
+	// The whole history starts with the game's notices
+	all := alice.Command("/history 100")
+	if m := historyLineRe.FindStringSubmatch(all[0]); m == nil || !strings.Contains(m[1], "alice has joined") {
+		t.Errorf("Expected alice joining first, got %q", all[0])
+	}
+	alice.Run([]Step{
+		{Send: "/history 5 nobody", Expect: []string{"history -- | No messages from nobody"}},
+	})
+}
+
+func TestRecallClamped(t *testing.T) {
+	g := NewGame("recall", RealClock{}, NewRand(1))
+	for i := 0; i < HISTORY_SIZE+10; i++ {
+		g.Remember("alice", Message{From: "bob", Text: "hi\n"})
+	}
+	if entries := g.Recall("alice", int(^uint(0)>>1), ""); len(entries) != HISTORY_SIZE {
+		t.Errorf("Expected %d messages, got %d", HISTORY_SIZE, len(entries))
+	}
+}
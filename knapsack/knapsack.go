@@ -0,0 +1,400 @@
+// Package knapsack solves the multiple knapsack problem behind the game: which
+// agent sends which file so the team gets the most secrecy to the NPC. The
+// server's hints and AI agents and the reference bot all plan with it.
+package knapsack
+
+import (
+	"sort"
+)
+
+// Kinds of Pair
+const (
+	DEPENDS   = iota // the items are only worth anything if both are taken
+	CONFLICTS        // taking both is not allowed
+)
+
+// Item is something to pack, a file in the game. Costs are what it takes of
+// the agents' other budgets, and only agents cleared for its Clearance can
+// take it, "" for anyone.
+type Item struct {
+	Name      string
+	Size      int
+	Value     int
+	Costs     []int
+	Clearance string
+}
+
+// An agent that can take items, Capacity is the room left, Budgets what is
+// left of any other resources and Clearances the items they are allowed to
+// take. Passing one of the items in Holds to another agent uses up one of
+// Handoffs, items nobody holds move freely.
+type Agent struct {
+	Name       string
+	Capacity   int
+	Budgets    []int
+	Clearances []string
+	Holds      []string
+	Handoffs   int
+}
+
+// Pair ties two items together by name
+type Pair struct {
+	Kind  int
+	Items [2]string
+}
+
+// Solution gives the agent taking each item, by its index in the items
+// solved, or -1 for items left out
+type Solution struct {
+	Assign []int
+	Score  int
+}
+
+// Cleared reports whether an agent with clearances can take it
+func Cleared(clearances []string, it Item) bool {
+	if it.Clearance == "" {
+		return true
+	}
+	for _, c := range clearances {
+		if c == it.Clearance {
+			return true
+		}
+	}
+	return false
+}
+
+// Solve finds the assignment of items to agents with the highest total
+// value that fits every agent's capacity. It is an exhaustive branch and
+// bound search, which is plenty for the handful of files in a game. Pairs
+// with items not in items are ignored.
+func Solve(items []Item, agents []Agent, pairs ...Pair) Solution {
+	s := &solver{
+		items:     make([]Item, 0, len(items)),
+		origin:    make([]int, 0, len(items)),
+		agents:    agents,
+		capacity:  make([]int, len(agents)),
+		budgets:   make([][]int, len(agents)),
+		assign:    make([]int, len(items)),
+		best:      make([]int, len(items)),
+		depends:   make([][]int, len(items)),
+		conflicts: make([][]int, len(items)),
+	}
+
+	// Items that only count together are searched and bounded as one group
+	index := make(map[string]int)
+	for i, it := range items {
+		index[it.Name] = i
+	}
+	paired := make(map[int]bool)
+	groups := make([][]int, 0, len(items))
+	for _, p := range pairs {
+		a, okA := index[p.Items[0]]
+		b, okB := index[p.Items[1]]
+		if p.Kind == DEPENDS && okA && okB && !paired[a] && !paired[b] {
+			paired[a], paired[b] = true, true
+			groups = append(groups, []int{a, b})
+		}
+	}
+	for i := range items {
+		if !paired[i] {
+			groups = append(groups, []int{i})
+		}
+	}
+	// Best value per size first so the bound tightens quickly
+	sort.SliceStable(groups, func(i, j int) bool {
+		return value(items, groups[i])*size(items, groups[j]) > value(items, groups[j])*size(items, groups[i])
+	})
+	for _, group := range groups {
+		indices := make([]int, 0, len(group))
+		for _, i := range group {
+			index[items[i].Name] = len(s.items)
+			s.groupOf = append(s.groupOf, len(s.groups))
+			indices = append(indices, len(s.items))
+			s.items = append(s.items, items[i])
+			s.origin = append(s.origin, i)
+		}
+		s.groups = append(s.groups, indices)
+		s.sizes = append(s.sizes, size(items, group))
+		s.values = append(s.values, value(items, group))
+	}
+
+	for _, p := range pairs {
+		a, okA := index[p.Items[0]]
+		b, okB := index[p.Items[1]]
+		if !okA || !okB {
+			continue
+		}
+		s.constrained = true
+		if p.Kind == DEPENDS {
+			s.depends[a] = append(s.depends[a], b)
+			s.depends[b] = append(s.depends[b], a)
+		} else {
+			s.conflicts[a] = append(s.conflicts[a], b)
+			s.conflicts[b] = append(s.conflicts[b], a)
+		}
+	}
+	s.holder = make([]int, len(s.items))
+	for i := range s.holder {
+		s.holder[i] = -1
+	}
+	s.handoffs = make([]int, len(agents))
+	for i, a := range agents {
+		for _, name := range a.Holds {
+			if j, ok := index[name]; ok {
+				s.holder[j] = i
+				s.routed = true
+			}
+		}
+		s.handoffs[i] = a.Handoffs
+		s.capacity[i] = a.Capacity
+		s.budgets[i] = make([]int, len(a.Budgets))
+		copy(s.budgets[i], a.Budgets)
+	}
+	for i := range s.best {
+		s.best[i] = -1
+	}
+	s.search(0, 0)
+
+	assign := make([]int, len(items))
+	for i, a := range s.best {
+		assign[s.origin[i]] = a
+	}
+	return Solution{Assign: assign, Score: s.bestScore}
+}
+
+func size(items []Item, group []int) int {
+	total := 0
+	for _, i := range group {
+		total += items[i].Size
+	}
+	return total
+}
+
+func value(items []Item, group []int) int {
+	total := 0
+	for _, i := range group {
+		total += items[i].Value
+	}
+	return total
+}
+
+type solver struct {
+	items     []Item // In search order
+	origin    []int  // Index of each item in what was solved
+	groups    [][]int
+	groupOf   []int
+	sizes     []int
+	values    []int
+	agents    []Agent
+	capacity  []int
+	budgets   [][]int
+	assign    []int
+	best      []int
+	bestScore int
+	// Items each item depends on or conflicts with, by index
+	depends     [][]int
+	conflicts   [][]int
+	constrained bool
+	// The agent holding each item and the hand-offs each agent has left
+	holder   []int
+	handoffs []int
+	routed   bool
+}
+
+// search tries every assignment of items from i on. Plans that take an item
+// without one it depends on are skipped, they are never better than the same
+// plan without it. score counts items whose dependencies are not decided
+// yet, so it is only a best score once they are.
+func (s *solver) search(i int, score int) {
+	if score > s.bestScore && (!s.constrained || s.settled(i)) {
+		s.bestScore = score
+		copy(s.best, s.assign[:i])
+		for j := i; j < len(s.best); j++ {
+			s.best[j] = -1
+		}
+	}
+	if i == len(s.items) || score+s.bound(i) <= s.bestScore {
+		return
+	}
+
+	it := s.items[i]
+	for a := range s.agents {
+		if s.constrained && s.excluded(i, i) {
+			break
+		}
+		if !s.fits(a, it) {
+			continue
+		}
+		// Agents with the same capacity and clearances left are interchangeable
+		dup := false
+		for b := 0; b < a; b++ {
+			if s.same(a, b) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		h := s.holder[i]
+		if h >= 0 && h != a {
+			if s.handoffs[h] <= 0 {
+				continue
+			}
+			s.handoffs[h]--
+		}
+		s.take(a, it, 1)
+		s.assign[i] = a
+		s.search(i+1, score+it.Value)
+		s.take(a, it, -1)
+		if h >= 0 && h != a {
+			s.handoffs[h]++
+		}
+	}
+	s.assign[i] = -1
+	if !s.constrained || !s.required(i) {
+		s.search(i+1, score)
+	}
+}
+
+// settled reports whether every item taken among the first i has the items
+// it depends on decided
+func (s *solver) settled(i int) bool {
+	for j := 0; j < i; j++ {
+		if s.assign[j] < 0 {
+			continue
+		}
+		for _, k := range s.depends[j] {
+			if k >= i {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// excluded reports whether item j can no longer be taken once the first i
+// items are decided, because of an item it conflicts with or depends on
+func (s *solver) excluded(j int, i int) bool {
+	for _, k := range s.conflicts[j] {
+		if k < i && s.assign[k] >= 0 {
+			return true
+		}
+	}
+	for _, k := range s.depends[j] {
+		if k < i && s.assign[k] < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// blocked reports whether any item of group left after the first i is
+// excluded
+func (s *solver) blocked(group []int, i int) bool {
+	for _, j := range group {
+		if j >= i && s.excluded(j, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// required reports whether an item already taken depends on item i
+func (s *solver) required(i int) bool {
+	for _, k := range s.depends[i] {
+		if k < i && s.assign[k] >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *solver) fits(a int, it Item) bool {
+	if s.capacity[a] < it.Size || !Cleared(s.agents[a].Clearances, it) {
+		return false
+	}
+	for k, cost := range it.Costs {
+		if k < len(s.budgets[a]) && s.budgets[a][k] < cost {
+			return false
+		}
+	}
+	return true
+}
+
+// take uses up the costs of it from agent a, or gives them back when sign is -1
+func (s *solver) take(a int, it Item, sign int) {
+	s.capacity[a] -= sign * it.Size
+	for k, cost := range it.Costs {
+		if k < len(s.budgets[a]) {
+			s.budgets[a][k] -= sign * cost
+		}
+	}
+}
+
+func (s *solver) same(a int, b int) bool {
+	if s.capacity[a] != s.capacity[b] || !sameStrings(s.agents[a].Clearances, s.agents[b].Clearances) {
+		return false
+	}
+	// Agents holding items cost different hand-offs to pass them on
+	if s.routed && (len(s.agents[a].Holds) > 0 || len(s.agents[b].Holds) > 0) {
+		return false
+	}
+	for k := range s.budgets[a] {
+		if s.budgets[a][k] != s.budgets[b][k] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bound is the fractional relaxation of the remaining groups into the
+// remaining total capacity, an upper bound on what they can add. Other
+// resources and conflicts only make the bound looser.
+func (s *solver) bound(i int) int {
+	room := 0
+	for _, c := range s.capacity {
+		room += c
+	}
+	bound := 0
+	if i == len(s.items) {
+		return 0
+	}
+	k := s.groupOf[i]
+	if group := s.groups[k]; group[0] < i {
+		// The rest of a group already started is out of ratio order, count
+		// it without using up room
+		if !s.blocked(group, i) {
+			for _, j := range group[i-group[0]:] {
+				bound += s.items[j].Value
+			}
+		}
+		k++
+	}
+	for ; k < len(s.groups) && room > 0; k++ {
+		if s.constrained && s.blocked(s.groups[k], i) {
+			continue
+		}
+		size, value := s.sizes[k], s.values[k]
+		if size <= room {
+			room -= size
+			bound += value
+		} else {
+			bound += (value*room + size - 1) / size
+			room = 0
+		}
+	}
+	return bound
+}
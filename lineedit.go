@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines the up arrow goes back through
+const MAX_HISTORY int = 50
+
+// LineEditor edits what a player types when their telnet client sends
+// every key as it is pressed, and echoes it back
+type LineEditor struct {
+	Line    []rune
+	Cursor  int
+	History []string
+	Masked  bool // Typing a password, nothing is echoed
+
+	// Completes the last word of the line before the cursor
+	Complete func(line string) []string
+
+	browsing int    // Where up and down are in History
+	esc      []byte // Escape sequence read so far
+	utf      []byte // Multi-byte character read so far
+	cr       bool   // The last byte was a CR, a LF after it is the same enter
+}
+
+// Key takes one byte the client sent. It returns what to echo, and the line
+// when the byte was the enter key
+func (e *LineEditor) Key(b byte) (string, string, bool) {
+	cr := e.cr
+	e.cr = b == '\r'
+	if len(e.esc) > 0 {
+		return e.escape(b), "", false
+	}
+	if len(e.utf) > 0 || b >= 0x80 {
+		e.utf = append(e.utf, b)
+		if !utf8.FullRune(e.utf) {
+			return "", "", false
+		}
+		r, _ := utf8.DecodeRune(e.utf)
+		e.utf = e.utf[:0]
+		if r == utf8.RuneError {
+			return "", "", false
+		}
+		return e.insert(r), "", false
+	}
+
+	switch b {
+	case '\r':
+		return e.enter()
+	case '\n':
+		if cr {
+			return "", "", false
+		}
+		return e.enter()
+	case 0x1b:
+		e.esc = append(e.esc, b)
+		return "", "", false
+	case 0x7f, 0x08:
+		if e.Cursor == 0 {
+			return "", "", false
+		}
+		e.Line = append(e.Line[:e.Cursor-1], e.Line[e.Cursor:]...)
+		e.Cursor--
+		return e.redraw(), "", false
+	case '\t':
+		return e.complete(), "", false
+	case 0x01:
+		e.Cursor = 0
+		return e.redraw(), "", false
+	case 0x05:
+		e.Cursor = len(e.Line)
+		return e.redraw(), "", false
+	case 0x03, 0x15:
+		// Ctrl-C and ctrl-U clear the line
+		e.set("")
+		return e.redraw(), "", false
+	case 0x17:
+		// Ctrl-W deletes the word before the cursor
+		start := e.Cursor
+		for start > 0 && e.Line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && e.Line[start-1] != ' ' {
+			start--
+		}
+		e.Line = append(e.Line[:start], e.Line[e.Cursor:]...)
+		e.Cursor = start
+		return e.redraw(), "", false
+	}
+	if b < 0x20 {
+		return "", "", false
+	}
+	return e.insert(rune(b)), "", false
+}
+
+func (e *LineEditor) escape(b byte) string {
+	e.esc = append(e.esc, b)
+	seq := string(e.esc)
+	if len(e.esc) == 2 && b != '[' && b != 'O' {
+		e.esc = e.esc[:0]
+		return ""
+	}
+	if len(e.esc) < 3 || (b < 0x40 || b > 0x7e) && len(e.esc) < 8 {
+		return ""
+	}
+	e.esc = e.esc[:0]
+	switch seq[1:] {
+	case "[A", "OA":
+		if e.browsing > 0 && !e.Masked {
+			e.browsing--
+			e.set(e.History[e.browsing])
+		}
+	case "[B", "OB":
+		if e.browsing < len(e.History) && !e.Masked {
+			e.browsing++
+			if e.browsing == len(e.History) {
+				e.set("")
+			} else {
+				e.set(e.History[e.browsing])
+			}
+		}
+	case "[C", "OC":
+		if e.Cursor < len(e.Line) {
+			e.Cursor++
+		}
+	case "[D", "OD":
+		if e.Cursor > 0 {
+			e.Cursor--
+		}
+	case "[H", "OH", "[1~":
+		e.Cursor = 0
+	case "[F", "OF", "[4~":
+		e.Cursor = len(e.Line)
+	case "[3~":
+		if e.Cursor < len(e.Line) {
+			e.Line = append(e.Line[:e.Cursor], e.Line[e.Cursor+1:]...)
+		}
+	default:
+		return ""
+	}
+	return e.redraw()
+}
+
+func (e *LineEditor) insert(r rune) string {
+	e.Line = append(e.Line[:e.Cursor], append([]rune{r}, e.Line[e.Cursor:]...)...)
+	e.Cursor++
+	if e.Masked {
+		return ""
+	}
+	if e.Cursor == len(e.Line) {
+		return string(r)
+	}
+	return e.redraw()
+}
+
+func (e *LineEditor) enter() (string, string, bool) {
+	line := string(e.Line)
+	if !e.Masked && strings.TrimSpace(line) != "" && (len(e.History) == 0 || e.History[len(e.History)-1] != line) {
+		e.History = append(e.History, line)
+		if len(e.History) > MAX_HISTORY {
+			e.History = e.History[1:]
+		}
+	}
+	e.browsing = len(e.History)
+	e.set("")
+	return "\r\n", line, true
+}
+
+func (e *LineEditor) set(line string) {
+	e.Line = []rune(line)
+	e.Cursor = len(e.Line)
+}
+
+// Clear rubs out the line on the client's screen
+func (e *LineEditor) Clear() string {
+	if len(e.Line) == 0 || e.Masked {
+		return ""
+	}
+	return "\r\x1b[K"
+}
+
+// Draw writes the line out again, with the cursor where it was
+func (e *LineEditor) Draw() string {
+	if e.Masked {
+		return ""
+	}
+	text := string(e.Line)
+	if back := len(e.Line) - e.Cursor; back > 0 {
+		text += fmt.Sprintf("\x1b[%dD", back)
+	}
+	return text
+}
+
+func (e *LineEditor) redraw() string {
+	if e.Masked {
+		return ""
+	}
+	return "\r\x1b[K" + e.Draw()
+}
+
+// complete finishes the word before the cursor, or lists what it could be.
+// Candidates with spaces come quoted, they also match the word typed
+// without its opening quote.
+func (e *LineEditor) complete() string {
+	if e.Complete == nil || e.Masked {
+		return ""
+	}
+	before := string(e.Line[:e.Cursor])
+	_, start := TypedWords(before)
+	word := before[start:]
+	matches := make([]string, 0)
+	for _, c := range e.Complete(before) {
+		if strings.HasPrefix(c, word) || strings.HasPrefix(c, `"`+word) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return "\a"
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(matches) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		// The word is replaced, it may gain its opening quote
+		cut := e.Cursor - utf8.RuneCountInString(word)
+		e.Line = append(e.Line[:cut], append([]rune(prefix), e.Line[e.Cursor:]...)...)
+		e.Cursor = cut + utf8.RuneCountInString(prefix)
+		return e.redraw()
+	}
+	return "\r\n" + strings.Join(matches, "  ") + "\r\n" + e.Draw()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	e := &LineEditor{Complete: func(line string) []string {
+		return []string{"peer_review_hilarious.txt", "peer_pressure.pdf", "budget.xls", `"my notes.txt"`}
+	}}
+	tests := []struct {
+		Keys string
+		Line string
+	}{
+		{"helo\x1b[Dl\r\n", "hello"},
+		{"ab\x01x\x05y\r", "xaby"},
+		{"word gone\x17\x17kept\r", "kept"},
+		{"abc\x7f\x7f\x1b[3~d\r", "ad"},
+		{"junk\x15\x1b[A\x1b[A\r", "kept"},
+		{"/send bob peer_r\t\r", "/send bob peer_review_hilarious.txt "},
+		{"/send bob p\tp\t\r", "/send bob peer_pressure.pdf "},
+		{"/send bob my\t\r", `/send bob "my notes.txt" `},
+		{"/send bob \"my n\t\r", `/send bob "my notes.txt" `},
+		{"señor\r", "señor"},
+	}
+	for _, test := range tests {
+		lines := make([]string, 0)
+		for _, b := range []byte(test.Keys) {
+			if _, line, done := e.Key(b); done {
+				lines = append(lines, line)
+			}
+		}
+		if !reflect.DeepEqual(lines, []string{test.Line}) {
+			t.Errorf("%q: expected %q, got %q", test.Keys, test.Line, lines)
+		}
+	}
+	if echo, _, _ := e.Key('\t'); echo != "\r\n\"my notes.txt\"  budget.xls  peer_pressure.pdf  peer_review_hilarious.txt\r\n" {
+		t.Errorf("Expected the candidates listed, got %q", echo)
+	}
+
+	e.Masked = true
+	// Neither arrow brings a line back into a password
+	e.browsing = 0
+	for _, b := range []byte("\x1b[A\x1b[B") {
+		e.Key(b)
+	}
+	if len(e.Line) != 0 {
+		t.Errorf("Expected no history in a password, got %q", string(e.Line))
+	}
+	for _, b := range []byte("secret") {
+		if echo, _, _ := e.Key(b); echo != "" {
+			t.Errorf("Expected nothing echoed, got %q", echo)
+		}
+	}
+	e.Key('\r')
+	if last := e.History[len(e.History)-1]; last == "secret" {
+		t.Errorf("Expected the password kept out of the history")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadTest drives scripted players through ConnectionHandler in the same
+// process, to find out how many games one server can run at once.
+type LoadTest struct {
+	Games       int
+	Concurrency int  // games in flight at once, 0 runs them all together
+	Rounds      int  // times each player runs its script of commands
+	TCP         bool // connect over loopback TCP instead of net.Pipe
+	Timeout     time.Duration
+	Seed        int64
+
+	connCh chan net.Conn
+	addr   string
+
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	completed int
+	failed    int
+	errors    map[string]int
+}
+
+type LoadTestReport struct {
+	Games          int
+	Completed      int
+	Failed         int
+	Errors         map[string]int
+	Elapsed        time.Duration
+	Commands       int
+	Latencies      map[string][]time.Duration
+	GoroutinesPeak int
+	GoroutinesLeft int
+	HeapBase       uint64
+	HeapPeak       uint64
+	InFlight       int
+}
+
+var loadListRe = regexp.MustCompile(`^list -- \|\s+(\S+)\s+\d+ KB\s+\d+$`)
+
+func NewLoadTest(games int) *LoadTest {
+	return &LoadTest{
+		Games:     games,
+		Rounds:    3,
+		Timeout:   30 * time.Second,
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+func (lt *LoadTest) Run() (*LoadTestReport, error) {
+	lt.connCh = make(chan net.Conn, 100)
+	gameRequestCh := make(chan GameRequest, 100)
+	// The synthetic players' games are not worth saving
+	stores := MemoryStores()
+	go ConnectionHandler(lt.connCh, gameRequestCh, stores)
+	go GameHandler(gameRequestCh, RealClock{}, lt.Seed, stores)
+
+	if lt.TCP {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		lt.addr = ln.Addr().String()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				lt.connCh <- conn
+			}
+		}()
+	}
+
+	inFlight := lt.Concurrency
+	if inFlight <= 0 || inFlight > lt.Games {
+		inFlight = lt.Games
+	}
+	report := &LoadTestReport{Games: lt.Games, InFlight: inFlight}
+
+	var mem runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&mem)
+	report.HeapBase = mem.HeapInuse
+	baseGoroutines := runtime.NumGoroutine()
+
+	stopSampling := make(chan bool)
+	sampled := make(chan bool)
+	go func() {
+		defer close(sampled)
+		var mem runtime.MemStats
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				runtime.ReadMemStats(&mem)
+				if mem.HeapInuse > report.HeapPeak {
+					report.HeapPeak = mem.HeapInuse
+				}
+				if n := runtime.NumGoroutine(); n > report.GoroutinesPeak {
+					report.GoroutinesPeak = n
+				}
+			case <-stopSampling:
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	slots := make(chan bool, inFlight)
+	var wg sync.WaitGroup
+	for i := 0; i < lt.Games; i++ {
+		slots <- true
+		wg.Add(1)
+		go func(room string) {
+			defer wg.Done()
+			lt.playGame(room)
+			<-slots
+		}(fmt.Sprintf("load%d", i))
+	}
+	wg.Wait()
+	report.Elapsed = time.Now().Sub(start)
+	close(stopSampling)
+	<-sampled
+
+	// Give finished games a moment to tear down before counting leftovers
+	time.Sleep(100 * time.Millisecond)
+	report.GoroutinesLeft = runtime.NumGoroutine() - baseGoroutines
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	report.Completed = lt.completed
+	report.Failed = lt.failed
+	report.Errors = lt.errors
+	report.Latencies = lt.latencies
+	for _, l := range lt.latencies {
+		report.Commands += len(l)
+	}
+	return report, nil
+}
+
+func (lt *LoadTest) playGame(room string) {
+	names := make([]string, MAX_NUM_CLIENTS)
+	for i := range names {
+		names[i] = fmt.Sprintf("agent%d", i+1)
+	}
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		teammate := names[(i+1)%len(names)]
+		wg.Add(1)
+		go func(name string, teammate string) {
+			defer wg.Done()
+			err := lt.playAgent(room, name, teammate)
+			lt.mu.Lock()
+			defer lt.mu.Unlock()
+			if err != nil {
+				lt.failed++
+				lt.errors[err.Error()]++
+				return
+			}
+			lt.completed++
+		}(name, teammate)
+	}
+	wg.Wait()
+}
+
+func (lt *LoadTest) dial() (net.Conn, error) {
+	if lt.TCP {
+		return net.Dial("tcp", lt.addr)
+	}
+	client, server := net.Pipe()
+	lt.connCh <- server
+	return client, nil
+}
+
+// loadAgent is one scripted player's end of the connection
+type loadAgent struct {
+	conn    net.Conn
+	lines   chan string
+	timeout time.Duration
+	files   []string
+}
+
+func (lt *LoadTest) playAgent(room string, name string, teammate string) error {
+	conn, err := lt.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	a := &loadAgent{conn: conn, lines: make(chan string, 100), timeout: lt.Timeout}
+	go a.read()
+
+	if err := a.answer("collaboration channel", room); err != nil {
+		return err
+	}
+	if err := a.answer("Enter a nickname", name); err != nil {
+		return err
+	}
+	if _, err := a.expect("mission starting"); err != nil {
+		return err
+	}
+
+	for i := 0; i < lt.Rounds; i++ {
+		if err := lt.timed("/list", a, "/list", "list -- | Remaining Bandwidth"); err != nil {
+			return err
+		}
+		if err := lt.timed("/msg", a, fmt.Sprintf("/msg %s ping", name), name+" | ping"); err != nil {
+			return err
+		}
+		if err := lt.timed("/status", a, "/status", "status -- | Mission"); err != nil {
+			return err
+		}
+		if len(a.files) > 0 {
+			file := a.files[0]
+			a.files = a.files[1:]
+			if err := lt.timed("/send", a, fmt.Sprintf("/send %s %s", teammate, file), "send -- | Sent file"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := a.write("/msg Glenda done"); err != nil {
+		return err
+	}
+	if _, err := a.expect("Game ended"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (lt *LoadTest) timed(command string, a *loadAgent, text string, response string) error {
+	start := time.Now()
+	if err := a.write(text); err != nil {
+		return err
+	}
+	if _, err := a.expect(response); err != nil {
+		return fmt.Errorf("%s: %s", command, err.Error())
+	}
+	elapsed := time.Now().Sub(start)
+
+	lt.mu.Lock()
+	lt.latencies[command] = append(lt.latencies[command], elapsed)
+	lt.mu.Unlock()
+	return nil
+}
+
+func (a *loadAgent) read() {
+	bufr := bufio.NewReader(a.conn)
+	defer close(a.lines)
+	for {
+		line, err := bufr.ReadString('\n')
+		if err != nil {
+			return
+		}
+		a.lines <- strings.TrimRight(line, "\r\n")
+	}
+}
+
+func (a *loadAgent) write(text string) error {
+	_, err := io.WriteString(a.conn, text+"\n")
+	return err
+}
+
+func (a *loadAgent) answer(prompt string, text string) error {
+	if _, err := a.expect(prompt); err != nil {
+		return err
+	}
+	return a.write(text)
+}
+
+// expect reads lines until one contains text, keeping track of the files
+// the agent holds along the way
+func (a *loadAgent) expect(text string) (string, error) {
+	timeout := time.After(a.timeout)
+	for {
+		select {
+		case line, ok := <-a.lines:
+			if !ok {
+				return "", errors.New("connection closed")
+			}
+			if m := loadListRe.FindStringSubmatch(line); m != nil && m[1] != "Filename" {
+				a.addFile(m[1])
+			}
+			if strings.HasPrefix(line, "send -- | Received file: ") {
+				a.addFile(strings.TrimPrefix(line, "send -- | Received file: "))
+			}
+			if strings.Contains(line, text) {
+				return line, nil
+			}
+		case <-timeout:
+			return "", fmt.Errorf("timed out waiting for %q", text)
+		}
+	}
+}
+
+func (a *loadAgent) addFile(filename string) {
+	for _, f := range a.files {
+		if f == filename {
+			return
+		}
+	}
+	a.files = append(a.files, filename)
+}
+
+// Percentile returns the p-th percentile of sorted durations
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+func (r *LoadTestReport) String() string {
+	text := fmt.Sprintf("games:       %d (%d in flight), %d agents finished, %d failed\n",
+		r.Games, r.InFlight, r.Completed, r.Failed)
+	text += fmt.Sprintf("elapsed:     %s\n", r.Elapsed)
+	seconds := r.Elapsed.Seconds()
+	text += fmt.Sprintf("throughput:  %.1f games/s, %.1f commands/s\n",
+		float64(r.Games)/seconds, float64(r.Commands)/seconds)
+	text += fmt.Sprintf("goroutines:  %d peak, %d left after all games ended\n", r.GoroutinesPeak, r.GoroutinesLeft)
+	if r.HeapPeak > r.HeapBase && r.InFlight > 0 {
+		text += fmt.Sprintf("memory:      %d KB peak heap, %.1f KB per game in flight\n",
+			r.HeapPeak/1024, float64(r.HeapPeak-r.HeapBase)/1024/float64(r.InFlight))
+	}
+
+	commands := make([]string, 0, len(r.Latencies))
+	for command := range r.Latencies {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	text += fmt.Sprintf("%-8s  %7s  %10s  %10s  %10s  %10s\n", "command", "count", "p50", "p90", "p99", "max")
+	for _, command := range commands {
+		l := r.Latencies[command]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		text += fmt.Sprintf("%-8s  %7d  %10s  %10s  %10s  %10s\n", command, len(l),
+			Percentile(l, 50), Percentile(l, 90), Percentile(l, 99), l[len(l)-1])
+	}
+
+	for err, n := range r.Errors {
+		text += fmt.Sprintf("error: %s (%d)\n", err, n)
+	}
+	return text
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Every line a player reads is a message in a catalog, one catalog per
+// language. Messages are fmt templates under a key, translations can
+// reorder the arguments with %[2]s. Translators can add or override
+// catalogs by pointing LOCALE_DIR at a directory of files laid out like
+// locale/en.json.
+
+//go:embed locale/*.json
+var localeFiles embed.FS
+
+// Language of the messages every other catalog falls back to
+const SOURCE_LANG string = "en"
+
+// Language players get until they pick one with /lang. Set with -lang.
+var DefaultLang string = SOURCE_LANG
+
+type Catalog struct {
+	Lang     string            `json:"lang"`
+	Name     string            `json:"name"` // What the language calls itself
+	Messages map[string]string `json:"messages"`
+}
+
+var Catalogs map[string]*Catalog = MustLoadCatalogs()
+
+func MustLoadCatalogs() map[string]*Catalog {
+	catalogs := make(map[string]*Catalog)
+	entries, err := localeFiles.ReadDir("locale")
+	if err != nil {
+		panic(fmt.Sprintf("invalid locales: %s", err.Error()))
+	}
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile("locale/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("invalid locale %s: %s", entry.Name(), err.Error()))
+		}
+		cat, err := ParseCatalog(data)
+		if err != nil {
+			panic(fmt.Sprintf("invalid locale %s: %s", entry.Name(), err.Error()))
+		}
+		catalogs[cat.Lang] = cat
+	}
+
+	dir := os.Getenv("LOCALE_DIR")
+	if dir == "" {
+		return catalogs
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		log.Printf("Error listing locales in %s: %s", dir, err.Error())
+		return catalogs
+	}
+	for _, path := range paths {
+		cat, err := LoadCatalog(path)
+		if err != nil {
+			log.Printf("Error loading locale %s, skipping it: %s", path, err.Error())
+			continue
+		}
+		if existing, ok := catalogs[cat.Lang]; ok {
+			existing.Merge(cat)
+			continue
+		}
+		catalogs[cat.Lang] = cat
+	}
+	return catalogs
+}
+
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(data)
+}
+
+func ParseCatalog(data []byte) (*Catalog, error) {
+	cat := &Catalog{}
+	if err := json.Unmarshal(data, cat); err != nil {
+		return nil, err
+	}
+	if cat.Lang == "" {
+		return nil, fmt.Errorf("missing lang")
+	}
+	if cat.Messages == nil {
+		cat.Messages = make(map[string]string)
+	}
+	return cat, nil
+}
+
+// Merge adds the messages of other to cat, replacing the ones with the same
+// key
+func (cat *Catalog) Merge(other *Catalog) {
+	if other.Name != "" {
+		cat.Name = other.Name
+	}
+	for k, v := range other.Messages {
+		cat.Messages[k] = v
+	}
+}
+
+// Langs returns the codes of every catalog in order
+func Langs() []string {
+	langs := make([]string, 0, len(Catalogs))
+	for lang := range Catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Text renders the message under key with args. Args that are Texts
+// themselves are rendered in the same language first.
+func (cat *Catalog) Text(key string, args ...interface{}) string {
+	template, ok := cat.Messages[key]
+	if !ok {
+		template, ok = Catalogs[SOURCE_LANG].Messages[key]
+	}
+	if !ok {
+		log.Printf("Missing message %s", key)
+		return key
+	}
+	rendered := make([]interface{}, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(Text); ok {
+			rendered[i] = cat.Text(t.Key, t.Args...)
+		} else {
+			rendered[i] = arg
+		}
+	}
+	return fmt.Sprintf(template, rendered...)
+}
+
+// A Text is a message waiting to be rendered in whichever language its
+// reader picked
+type Text struct {
+	Key  string
+	Args []interface{}
+}
+
+func T(key string, args ...interface{}) Text {
+	return Text{Key: key, Args: args}
+}
+
+// Texts can be returned as errors, they read in the default language until
+// they reach a player
+func (t Text) Error() string {
+	return Tr(t.Key, t.Args...)
+}
+
+// Tr renders a message in the default language and scenario, for output
+// that isn't for any one player
+func Tr(key string, args ...interface{}) string {
+	return FindScenario(DefaultScenario).Catalog(DefaultLang).Text(key, args...)
+}
+
+// Catalog is the language the player picked, as told in their game's
+// scenario
+func (c *Client) Catalog() *Catalog {
+	if c.Game != nil {
+		return c.Game.Scenario.Catalog(c.Lang)
+	}
+	return FindScenario(DefaultScenario).Catalog(c.Lang)
+}
+
+func (c *Client) Tr(key string, args ...interface{}) string {
+	return c.Catalog().Text(key, args...)
+}
+
+// Tell queues a message for the player in their language
+func (c *Client) Tell(key string, args ...interface{}) {
+	c.MsgCh <- Message{Text: c.Tr(key, args...)}
+}
+
+var langCommandRe = regexp.MustCompile(`^/lang(?: +(\S*))?$`)
+
+// Language lists the languages, or switches the player to another one
+func (c *Client) Language(lang string) {
+	if lang == "" {
+		c.MsgCh <- Message{Text: c.LanguagesText()}
+		return
+	}
+	if !c.PickLanguage(lang) {
+		c.Tell("lang.unknown", lang, strings.Join(Langs(), ", "))
+		return
+	}
+	c.Tell("lang.set", c.Catalog().Name)
+}
+
+// PickLanguage switches the player to lang if there is a catalog for it
+func (c *Client) PickLanguage(lang string) bool {
+	lang = strings.ToLower(lang)
+	if _, ok := Catalogs[lang]; !ok {
+		return false
+	}
+	c.Lang = lang
+	return true
+}
+
+func (c *Client) LanguagesText() string {
+	cat := c.Catalog()
+	text := c.Tr("lang.current", cat.Name, cat.Lang)
+	for _, lang := range Langs() {
+		text += c.Tr("lang.available", lang, Catalogs[lang].Name)
+	}
+	return text
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var verbRe = regexp.MustCompile(`%(?:\[\d+\])?[-+# 0-9.*]*[a-zA-Z%]`)
+
+// verbs is the sorted list of verb letters in a template, ignoring argument
+// indexes so translations can reorder them
+func verbs(template string) string {
+	seen := make(map[string]int)
+	for _, v := range verbRe.FindAllString(template, -1) {
+		seen[v[len(v)-1:]]++
+	}
+	text := ""
+	for _, v := range "%dsvqx" {
+		text += strings.Repeat(string(v), seen[string(v)])
+	}
+	return text
+}
+
+func TestCatalogsMatchSource(t *testing.T) {
+	source := Catalogs[SOURCE_LANG]
+	for _, lang := range Langs() {
+		cat := Catalogs[lang]
+		for key, template := range source.Messages {
+			translated, ok := cat.Messages[key]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, key)
+				continue
+			}
+			if verbs(translated) != verbs(template) {
+				t.Errorf("%s: %s has verbs %q, want %q", lang, key, verbs(translated), verbs(template))
+			}
+		}
+		for key := range cat.Messages {
+			if _, ok := source.Messages[key]; !ok {
+				t.Errorf("%s: %s isn't in the %s catalog", lang, key, SOURCE_LANG)
+			}
+		}
+	}
+}
+
+func TestSourceKeysExist(t *testing.T) {
+	keyRe := regexp.MustCompile(`(?:Tr|Tell|T|Text|MsgAll|Fail|Say)\((?:\w+, )?"([a-z_]+\.[a-z_.]+)"`)
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range keyRe.FindAllStringSubmatch(string(data), -1) {
+			if _, ok := Catalogs[SOURCE_LANG].Messages[m[1]]; !ok {
+				t.Errorf("%s: no message %s", path, m[1])
+			}
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+
+	ana := s.Connect()
+	ana.Name = "ana"
+	ana.Expect(Tr(ROOM_MSG))
+	ana.Run([]Step{
+		{Send: "/lang xx", Expect: []string{`No catalog for "xx"`, Tr(ROOM_MSG)}},
+		{Send: "/lang es", Expect: []string{"Idioma cambiado a Español", Catalogs["es"].Text(ROOM_MSG)}},
+		{Send: room, Expect: []string{Catalogs["es"].Text(NICK_MSG)}},
+		{Send: "ana", Expect: []string{"ana ha entrado en"}},
+	})
+
+	ben := s.Join(room, "ben")
+	ben.Expect("ben has joined")
+	carl := s.Join(room, "carl")
+	ana.Expect("empieza la misión")
+	carl.Expect("mission starting")
+	ana.Run([]Step{
+		{Send: "/list", Expect: []string{"Ancho de banda restante"}},
+		{Send: "/lang", Expect: []string{"Tu idioma: Español (es)", "en   English"}},
+		{Send: "/lang en", Expect: []string{"Language set to English"}},
+		{Send: "/list", Expect: []string{"Remaining Bandwidth"}},
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Typed at the room prompt to be matched with a team instead
+const QUICK_PLAY string = "quick"
+
+const QUEUE_MSG string = "queue.waiting"
+
+// Players whose average percentage of optimal is further apart than this are
+// not matched, 0 matches anyone. Set with -match-spread.
+var MatchSkillSpread int = 0
+
+// After waiting this long a player is matched regardless of skill
+const MATCH_RELAX_AFTER time.Duration = 30 * time.Second
+
+// How often the queue is checked for players who waited long enough
+const MATCH_INTERVAL time.Duration = 5 * time.Second
+
+// A player in the matchmaking queue. Rating is their average percentage of
+// optimal, -1 before they complete a game.
+type Queued struct {
+	Client *Client
+	Rating int
+	Since  time.Time
+}
+
+// MatchQueue groups queued players into teams, longest waiting first
+type MatchQueue struct {
+	Time    Clock
+	Spread  int
+	waiting []Queued
+	rooms   int
+}
+
+func NewMatchQueue(clock Clock, spread int) *MatchQueue {
+	return &MatchQueue{Time: clock, Spread: spread}
+}
+
+func (q *MatchQueue) Add(c *Client, rating int) {
+	q.waiting = append(q.waiting, Queued{Client: c, Rating: rating, Since: q.Time.Now()})
+}
+
+// Remove takes c out of the queue, it reports false if they were not waiting
+func (q *MatchQueue) Remove(c *Client) bool {
+	for i, w := range q.waiting {
+		if w.Client == c {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Match takes every team it can out of the queue
+func (q *MatchQueue) Match() [][]*Client {
+	teams := make([][]*Client, 0)
+	for {
+		team := q.next()
+		if team == nil {
+			return teams
+		}
+		teams = append(teams, team)
+	}
+}
+
+// RoomName makes up a room for a matched team, the hyphen keeps players
+// from typing it at the room prompt
+func (q *MatchQueue) RoomName() string {
+	q.rooms++
+	return fmt.Sprintf("%s-%d", QUICK_PLAY, q.rooms)
+}
+
+func (q *MatchQueue) next() []*Client {
+	for i, first := range q.waiting {
+		picked := []int{i}
+		names := map[string]bool{first.Client.Name: true}
+		for j := i + 1; j < len(q.waiting) && len(picked) < MAX_NUM_CLIENTS; j++ {
+			other := q.waiting[j]
+			if !names[other.Client.Name] && q.compatible(first, other) {
+				picked = append(picked, j)
+				names[other.Client.Name] = true
+			}
+		}
+		if len(picked) < MAX_NUM_CLIENTS {
+			continue
+		}
+
+		team := make([]*Client, 0, len(picked))
+		for k := len(picked) - 1; k >= 0; k-- {
+			j := picked[k]
+			team = append([]*Client{q.waiting[j].Client}, team...)
+			q.waiting = append(q.waiting[:j], q.waiting[j+1:]...)
+		}
+		return team
+	}
+	return nil
+}
+
+func (q *MatchQueue) compatible(a Queued, b Queued) bool {
+	if q.Spread <= 0 || a.Rating < 0 || b.Rating < 0 {
+		return true
+	}
+	now := q.Time.Now()
+	if now.Sub(a.Since) >= MATCH_RELAX_AFTER || now.Sub(b.Since) >= MATCH_RELAX_AFTER {
+		return true
+	}
+	diff := a.Rating - b.Rating
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= q.Spread
+}
+
+// QuickPlay asks for the player's name and waits with them in the
+// matchmaking queue
+func QuickPlay(client *Client, gameRequestCh chan GameRequest, stores Stores) {
+	name, err := client.GetName(stores.Accounts)
+	if err != nil {
+		log.Printf("Error getting name: %s", err.Error())
+		client.End()
+		return
+	}
+	client.Name = name
+
+	if err := client.WriteString(client.Tr(QUEUE_MSG, MAX_NUM_CLIENTS)); err != nil {
+		client.End()
+		return
+	}
+	log.Printf("Player \"%s\" is looking for a team", name)
+	client.unqueued = make(chan bool)
+	gameRequestCh <- GameRequest{Client: client}
+	client.WatchQueued(gameRequestCh)
+}
+
+// Rating is the player's average percentage of optimal in profiles, -1
+// before they complete a game
+func Rating(profiles *ProfileStore, c *Client) int {
+	if p, ok := profiles.Get(ProfileKey(c)); ok && p.Completed > 0 {
+		return p.AveragePercent()
+	}
+	return -1
+}
+
+// WatchQueued reads c's connection while they wait for a team, so a player
+// who drops is taken out of the queue. Lines typed while waiting are
+// dropped. It returns once the queue lets go of them, from then on the game
+// reads their lines.
+func (c *Client) WatchQueued(gameRequestCh chan GameRequest) {
+	c.Read()
+	for {
+		select {
+		case <-c.InputCh:
+		case err := <-c.ErrCh:
+			// Kept for the game in case they are matched before the queue hears
+			c.ErrCh <- err
+			select {
+			case gameRequestCh <- GameRequest{Client: c, Left: true}:
+				<-c.unqueued
+			case <-c.unqueued:
+			}
+			return
+		case <-c.unqueued:
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatchQueue(t *testing.T) {
+	clock := NewFakeClock(time.Date(2015, 7, 8, 9, 0, 0, 0, time.UTC))
+	q := NewMatchQueue(clock, 10)
+	players := make([]*Client, 0)
+	for _, name := range []string{"ann", "ben", "cat", "dan", "eve"} {
+		players = append(players, &Client{Name: name})
+	}
+	q.Add(players[0], 90)
+	q.Add(players[1], 40)
+	q.Add(players[2], 85)
+	q.Add(players[3], -1)
+	if teams := q.Match(); len(teams) != 1 {
+		t.Fatalf("Expected 1 team, got %d", len(teams))
+	} else if teams[0][0] != players[0] || teams[0][1] != players[2] || teams[0][2] != players[3] {
+		t.Errorf("Expected ann, cat and dan to be matched")
+	}
+
+	// ben is still waiting and too far from eve and fay, and the same name
+	// is never matched twice
+	q.Add(players[4], 95)
+	q.Add(&Client{Name: "ben"}, 40)
+	q.Add(&Client{Name: "fay"}, 99)
+	if teams := q.Match(); len(teams) != 0 {
+		t.Fatalf("Expected no team yet, got %d", len(teams))
+	}
+	clock.Advance(MATCH_RELAX_AFTER)
+	teams := q.Match()
+	if len(teams) != 1 || teams[0][0] != players[1] || teams[0][1] != players[4] || teams[0][2].Name != "fay" {
+		t.Fatalf("Expected ben to be matched with eve and fay after waiting")
+	}
+	if len(q.waiting) != 1 {
+		t.Errorf("Expected the second ben to keep waiting")
+	}
+}
+
+func TestWatchQueued(t *testing.T) {
+	player, server := net.Pipe()
+	c := NewClient(server)
+	c.unqueued = make(chan bool)
+	requestCh := make(chan GameRequest)
+	go c.WatchQueued(requestCh)
+
+	// Lines typed while waiting don't hold up the connection
+	io.WriteString(player, "anyone there?\n")
+	player.Close()
+	if request := <-requestCh; request.Client != c || !request.Left {
+		t.Fatalf("Expected the dropped player to leave the queue, got %#v", request)
+	}
+	c.unqueued <- true
+	select {
+	case <-c.ErrCh:
+	default:
+		t.Errorf("Expected the error to be kept for a game that matched them")
+	}
+}
@@ -1,53 +1,16 @@
 package main
 
-const INTRO_MSG string = string(`A monolithic building appears before you. You have arrived at the office. Try
-not to act suspicious.
-`)
-
-const NICK_MSG string = "Enter a nickname:\n"
-
-const ROOM_MSG string = "Log in to your team's assigned collaboration channel:\n"
-
-const FULL_MSG string = "It seems your teammates have started without you. Exiting...\n"
-
-const LEFT_MSG string = "One of your teammates chickened out. Ending game...\n"
-
-const START_MSG string = string(`* -- | Everyone has arrived, mission starting...
-* -- | Ask for /help to get familiar around here
-`)
-
-const FAIL_MSG string = string(`fail | You wake up bleary eyed and alone in a concrete box. Your head has a
-fail | lump on the side. It seems corporate security noticed you didn't belong,
-fail | you should have acted faster. You wonder if you will ever see your
-fail | burrow again
-`)
-
-const HELP_MSG string = string(`help -- |  Usage:
-help -- |
-help -- |     /[cmd] [arguments]
-help -- |
-help -- |  Available commands:
-help -- |
-help -- |    /msg [to] [text]         send message to coworker
-help -- |    /list                    look at files you have access to
-help -- |    /send [to] [filename]    move file to coworker
-help -- |    /look                    show coworkers
-`)
-
-const GLENDA_MSG string = string(`Glenda | Psst, hey there. I'm going to need your help if we want to exfiltrate
-Glenda | these documents. You have clearance that I don't.
-Glenda |
-Glenda | You each have access to a different set of sensitive files. Within your
-Glenda | group you can freely send files to each other for further analysis.
-Glenda | However, when sending files to me, the corporate infrastructure team
-Glenda | will be alerted if you exceed your transfer quota. Working on too many
-Glenda | files will make them suspicious.
-Glenda |
-Glenda | Please optimize your transfers by the political impact it will create
-Glenda | without exceeding any individual transfer quota. The file's security
-Glenda | clearance is a good metric to go by for that. Thanks!
-Glenda |
-Glenda | When each of you is finished sending me files, send me the message
-Glenda | 'done'. I'll wait to hear this from all of you before we execute phase
-Glenda | two.
-`)
+// Keys of the messages at the edges of a game, their text is in the
+// catalogs under locale/
+const (
+	INTRO_MSG        string = "intro"
+	NICK_MSG         string = "prompt.nick"
+	ROOM_MSG         string = "prompt.room"
+	FULL_MSG         string = "game.full"
+	LEFT_MSG         string = "game.left"
+	START_MSG        string = "game.start"
+	CLOCK_MSG        string = "game.clock"
+	TIME_WARNING_MSG string = "game.time_warning"
+	FAIL_MSG         string = "game.fail"
+	LOBBY_MSG        string = "game.lobby_timeout"
+)
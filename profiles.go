@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Profile is one player's history over every game they finished
+type Profile struct {
+	Name      string
+	Account   bool // false for guests, known only by the nickname they typed
+	Played    int
+	Completed int
+	Failed    int
+	Exited    int
+	// Sum of the percentage of optimal over completed games
+	PercentTotal int
+	Secrecy      int
+	Teammates    map[string]int
+	Fastest      time.Duration
+}
+
+// How the game went for one player, as saved to their profile
+type Outcome struct {
+	Status    int
+	Percent   int
+	Secrecy   int
+	Teammates []string
+	Elapsed   time.Duration
+}
+
+// A ProfileStore with no Path keeps its profiles in memory
+type ProfileStore struct {
+	Path     string
+	mu       sync.Mutex
+	profiles map[string]*Profile
+}
+
+var Profiles *ProfileStore = NewProfileStore(GetProfileFile())
+
+func GetProfileFile() string {
+	path := os.Getenv("PROFILES_FILE")
+	if path == "" {
+		path = "profiles.json"
+	}
+	return path
+}
+
+func NewProfileStore(path string) *ProfileStore {
+	return &ProfileStore{Path: path}
+}
+
+func (s *ProfileStore) load() {
+	if s.profiles != nil {
+		return
+	}
+	s.profiles = make(map[string]*Profile)
+	if s.Path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading profiles: %s", err.Error())
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &s.profiles); err != nil {
+		log.Printf("Error parsing profiles: %s", err.Error())
+	}
+}
+
+// Get returns a copy of the profile saved under key
+func (s *ProfileStore) Get(key string) (Profile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	p, ok := s.profiles[key]
+	if !ok {
+		return Profile{}, false
+	}
+	profile := *p
+	profile.Teammates = make(map[string]int)
+	for k, v := range p.Teammates {
+		profile.Teammates[k] = v
+	}
+	return profile, true
+}
+
+// All returns every profile ordered by name
+func (s *ProfileStore) All() []Profile {
+	s.mu.Lock()
+	keys := make([]string, 0)
+	s.load()
+	for key := range s.profiles {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+	sort.Strings(keys)
+
+	profiles := make([]Profile, 0, len(keys))
+	for _, key := range keys {
+		p, _ := s.Get(key)
+		profiles = append(profiles, p)
+	}
+	return profiles
+}
+
+// Record adds a game to the profile saved under key
+func (s *ProfileStore) Record(key string, name string, o Outcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	p, ok := s.profiles[key]
+	if !ok {
+		p = &Profile{Name: name, Account: strings.HasPrefix(key, ACCOUNT_KEY_PREFIX)}
+		s.profiles[key] = p
+	}
+	if p.Teammates == nil {
+		p.Teammates = make(map[string]int)
+	}
+	p.Played++
+	p.Secrecy += o.Secrecy
+	for _, teammate := range o.Teammates {
+		p.Teammates[teammate]++
+	}
+	switch o.Status {
+	case RUNNING:
+		p.Completed++
+		p.PercentTotal += o.Percent
+		if p.Fastest == 0 || o.Elapsed < p.Fastest {
+			p.Fastest = o.Elapsed
+		}
+	case FAIL:
+		p.Failed++
+	case EXIT:
+		p.Exited++
+	}
+
+	if s.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.profiles, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0644)
+}
+
+// AveragePercent is the average percentage of optimal over completed games
+func (p Profile) AveragePercent() int {
+	if p.Completed == 0 {
+		return 0
+	}
+	return p.PercentTotal / p.Completed
+}
+
+// Favorites returns up to n teammates, most games together first
+func (p Profile) Favorites(n int) []string {
+	names := make([]string, 0, len(p.Teammates))
+	for name := range p.Teammates {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.Teammates[names[i]] != p.Teammates[names[j]] {
+			return p.Teammates[names[i]] > p.Teammates[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// Report is the profile in cat's language, as lines starting with prefix
+func (p Profile) Report(cat *Catalog, prefix string) string {
+	text := cat.Text("stats.agent", prefix, p.Name)
+	text += cat.Text("stats.games", prefix, p.Played, p.Completed, p.Failed, p.Exited)
+	text += cat.Text("stats.average", prefix, p.AveragePercent(), p.Secrecy)
+	if p.Fastest > 0 {
+		text += cat.Text("stats.fastest", prefix, p.Fastest)
+	}
+	favorites := p.Favorites(3)
+	if len(favorites) > 0 {
+		names := ""
+		for _, name := range favorites {
+			names += cat.Text("stats.favorite", name, p.Teammates[name])
+		}
+		text += cat.Text("stats.favorites", prefix, names)
+	}
+	return text
+}
+
+// ProfileKey is where a player's history is saved: under their account if
+// they logged in, otherwise under the nickname they typed
+func ProfileKey(c *Client) string {
+	if c.Account != "" {
+		return ACCOUNT_KEY_PREFIX + c.Account
+	}
+	return c.Name
+}
+
+// RecordProfiles saves how the game went to every player still in it. The
+// mission failed for those left behind by a teammate who walked out.
+func (g *Game) RecordProfiles() {
+	status := g.Status
+	if status == EXIT {
+		status = FAIL
+	}
+	for _, c := range g.Clients {
+		g.RecordProfile(c, status)
+	}
+}
+
+// RecordProfile saves the game to c's profile as ending with status. Only
+// the human teammates count towards their favourites.
+func (g *Game) RecordProfile(c *Client, status int) {
+	if c.AI != nil {
+		return
+	}
+	teammates := make([]string, 0, len(g.Clients)-1)
+	for _, other := range g.Clients {
+		if other != c && other.AI == nil {
+			teammates = append(teammates, other.Name)
+		}
+	}
+	o := Outcome{
+		Status:    status,
+		Percent:   g.PercentOfPar(),
+		Secrecy:   c.Exfiltrated,
+		Teammates: teammates,
+		Elapsed:   g.Clock.Duration - g.TimeLeft(),
+	}
+	if err := g.Profiles.Record(ProfileKey(c), c.Name, o); err != nil {
+		log.Printf("Error saving profile for %s: %s", c.Name, err.Error())
+	}
+}
+
+// Stats shows a player's history, their own without a name
+func (c *Client) Stats(name string) {
+	var p Profile
+	var ok bool
+	if name == "" {
+		name = c.Name
+		p, ok = c.Game.Profiles.Get(ProfileKey(c))
+	} else {
+		p, ok = c.Game.Profiles.Find(c.Game.Accounts, name)
+	}
+	if !ok {
+		c.Tell("stats.none", "stats -- | ", name)
+		return
+	}
+	c.MsgCh <- Message{Text: p.Report(c.Catalog(), "stats -- | ")}
+}
+
+// Find returns the profile of the account called name, or of the guest
+// nickname if nobody registered it
+func (s *ProfileStore) Find(accounts *AccountStore, name string) (Profile, bool) {
+	if accounts.Registered(name) {
+		return s.Get(ACCOUNT_KEY_PREFIX + AccountKey(name))
+	}
+	return s.Get(name)
+}
+
+// PrintStats is the command line report, for one player if name is set
+func PrintStats(profiles *ProfileStore, accounts *AccountStore, name string) string {
+	if name == "" {
+		return StatsReport(profiles)
+	}
+	p, ok := profiles.Find(accounts, name)
+	if !ok {
+		return Tr("stats.none", "", name)
+	}
+	return p.Report(FindScenario(DefaultScenario).Catalog(DefaultLang), "")
+}
+
+// StatsReport is the command line report over every profile
+func StatsReport(s *ProfileStore) string {
+	profiles := s.All()
+	if len(profiles) == 0 {
+		return Tr("stats.empty")
+	}
+	text := fmt.Sprintf("%-20s  %6s  %9s  %6s  %4s  %7s  %7s  %10s  %s\n",
+		Tr("stats.column.agent"), Tr("stats.column.played"), Tr("stats.column.completed"), Tr("stats.column.failed"),
+		Tr("stats.column.left"), Tr("stats.column.average"), Tr("stats.column.secrecy"), Tr("stats.column.fastest"),
+		Tr("stats.column.favorite"))
+	for _, p := range profiles {
+		fastest := "-"
+		if p.Fastest > 0 {
+			fastest = p.Fastest.String()
+		}
+		favorite := "-"
+		if f := p.Favorites(1); len(f) > 0 {
+			favorite = f[0]
+		}
+		name := p.Name
+		if !p.Account {
+			name = Tr("stats.guest", name)
+		}
+		text += fmt.Sprintf("%-20s  %6d  %9d  %6d  %4d  %6d%%  %7d  %10s  %s\n",
+			name, p.Played, p.Completed, p.Failed, p.Exited, p.AveragePercent(), p.Secrecy, fastest, favorite)
+	}
+	return text
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goph3r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profiles.json")
+
+	store := NewProfileStore(path)
+	store.Record("alice", "alice", Outcome{Status: RUNNING, Percent: 80, Secrecy: 200, Teammates: []string{"bob", "carol"}, Elapsed: 50 * time.Second})
+	store.Record("alice", "alice", Outcome{Status: RUNNING, Percent: 60, Secrecy: 100, Teammates: []string{"bob"}, Elapsed: 40 * time.Second})
+	store.Record("alice", "alice", Outcome{Status: FAIL, Secrecy: 50, Teammates: []string{"dave"}})
+
+	// Profiles survive a restart
+	p, ok := NewProfileStore(path).Get("alice")
+	if !ok {
+		t.Fatalf("Expected alice's profile after reloading")
+	}
+	if p.Played != 3 || p.Completed != 2 || p.Failed != 1 || p.Exited != 0 {
+		t.Errorf("Expected 3 games, 2 completed and 1 failed, got %#v", p)
+	}
+	if p.AveragePercent() != 70 || p.Secrecy != 350 || p.Fastest != 40*time.Second {
+		t.Errorf("Expected 70%%, 350 secrecy and 40s, got %d%%, %d and %s", p.AveragePercent(), p.Secrecy, p.Fastest)
+	}
+	if f := p.Favorites(2); len(f) != 2 || f[0] != "bob" || f[1] != "carol" {
+		t.Errorf("Expected favorites bob and carol, got %v", f)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("nora", "oscar", "pat")
+	for _, p := range players {
+		p.Send("/msg Glenda done")
+	}
+	for _, p := range players {
+		p.Expect("Game ended")
+		p.ExpectClosed()
+	}
+
+	nora := s.Join(s.Room(), "nora")
+	nora.Run([]Step{
+		{Send: "/stats", Expect: []string{"stats -- | Agent nora", "Games played: 1  Completed: 1"}},
+		{Send: "/stats oscar", Expect: []string{"stats -- | Agent oscar"}},
+		{Send: "/stats nobody", Expect: []string{"stats -- | nobody hasn't finished a game yet"}},
+	})
+}
+
+func TestExitProfile(t *testing.T) {
+	s := NewTestServer(t)
+	players := s.StartGame("nora", "oscar", "pat")
+	players[2].Close()
+	for _, p := range players[:2] {
+		p.Expect(Tr(LEFT_MSG))
+		p.ExpectClosed()
+	}
+
+	if p, _ := s.Stores.Profiles.Get("pat"); p.Played != 1 || p.Exited != 1 {
+		t.Errorf("Expected pat to have walked out of 1 game, got %#v", p)
+	}
+	if p, _ := s.Stores.Profiles.Get("nora"); p.Played != 1 || p.Failed != 1 || p.Exited != 0 {
+		t.Errorf("Expected nora to have failed 1 game, got %#v", p)
+	}
+}
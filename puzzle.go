@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"./knapsack"
+)
+
+// A Puzzle is the files to deal out and the bandwidth of each agent. Some
+// variants add more resources, then every file has a cost and every agent a
+// budget for each of them, in the order of Resources.
+type Puzzle struct {
+	Files      []File
+	Capacities []int
+	Resources  []Resource
+	Budgets    [][]int
+	// Pairs of files that have to be sent together, or must not be
+	Constraints []Constraint
+	// The clearances of each agent, for files with a Clearance
+	Clearances [][]string
+}
+
+const (
+	DEPENDS   = knapsack.DEPENDS   // the files are only worth anything if both are sent
+	CONFLICTS = knapsack.CONFLICTS // sending both alerts security
+)
+
+type Constraint struct {
+	Kind  int
+	Files [2]string
+}
+
+func (c Constraint) String() string {
+	return c.Text().Error()
+}
+
+// Text describes the constraint to the players
+func (c Constraint) Text() Text {
+	if c.Kind == DEPENDS {
+		return T("constraint.depends", c.Files[0], c.Files[1])
+	}
+	return T("constraint.conflicts", c.Files[0], c.Files[1])
+}
+
+// Partner returns the other file in the constraint, or "" if filename is not
+// in it
+func (c Constraint) Partner(filename string) string {
+	switch filename {
+	case c.Files[0]:
+		return c.Files[1]
+	case c.Files[1]:
+		return c.Files[0]
+	}
+	return ""
+}
+
+// A resource used up when sending files to Glenda, besides bandwidth. Its
+// name and unit are message keys.
+type Resource struct {
+	Name string
+	Unit string
+}
+
+var ACCESS_LOG = Resource{Name: "resource.access_log", Unit: "resource.access_log.unit"}
+
+// Most files any puzzle deals, a full team on hard
+const MAX_FILES int = MAX_TEAM_SIZE * (3 + HARD)
+
+// Chance an agent is cleared for each department besides their own
+var CLEARANCE_CHANCE = map[int]float64{
+	EASY:   0.5,
+	NORMAL: 0.3,
+	HARD:   0.15,
+}
+
+// Share of the total file size the team can send for each difficulty,
+// unless the scenario says otherwise
+var PUZZLE_TIGHTNESS = map[int]float64{
+	EASY:   0.6,
+	NORMAL: 0.45,
+	HARD:   0.35,
+}
+
+// TextbookPuzzle is the original sample problem, with shuffled filenames
+// from the scenario
+func TextbookPuzzle(rng *rand.Rand, s *Scenario) Puzzle {
+	return Puzzle{
+		Files:      GenerateFiles(rng, s.Filenames),
+		Capacities: []int{50, 81, 120},
+	}
+}
+
+// GeneratePuzzle makes a random puzzle for a team of agents. Harder puzzles
+// have more files per agent and less bandwidth to go around.
+func GeneratePuzzle(rng *rand.Rand, s *Scenario, agents int, difficulty int) Puzzle {
+	numFiles := agents * (3 + difficulty)
+	filenames := make([]string, len(s.Filenames))
+	copy(filenames, s.Filenames)
+	ShuffleStrings(filenames, rng)
+
+	files := make([]File, numFiles)
+	total := 0
+	for i := range files {
+		filename := filenames[i%len(filenames)]
+		if i >= len(filenames) {
+			filename = fmt.Sprintf("copy%d_%s", i/len(filenames), filename)
+		}
+		files[i] = File{
+			Filename: filename,
+			Size:     s.Sizes[0] + rng.Intn(s.Sizes[1]-s.Sizes[0]+1),
+			Secrecy:  s.Secrecy[0] + rng.Intn(s.Secrecy[1]-s.Secrecy[0]+1),
+		}
+		total += files[i].Size
+	}
+
+	// Split the bandwidth unevenly, each agent gets half to one and a half
+	// times an even share
+	bandwidth := int(float64(total) * s.Share(difficulty))
+	capacities := make([]int, agents)
+	for i := range capacities {
+		share := bandwidth / agents
+		capacities[i] = share/2 + rng.Intn(share+1)
+	}
+	return Puzzle{Files: files, Capacities: capacities}
+}
+
+// AddResource gives every file a cost of 1 to maxCost in r, and every agent a
+// budget for it as tight as the puzzle's bandwidth
+func (p *Puzzle) AddResource(rng *rand.Rand, r Resource, maxCost int, tightness float64) {
+	total := 0
+	for i := range p.Files {
+		cost := 1 + rng.Intn(maxCost)
+		p.Files[i].Costs = append(p.Files[i].Costs, cost)
+		total += cost
+	}
+
+	agents := len(p.Capacities)
+	share := int(float64(total)*tightness) / agents
+	if len(p.Budgets) < agents {
+		p.Budgets = make([][]int, agents)
+	}
+	for i := range p.Budgets {
+		p.Budgets[i] = append(p.Budgets[i], share/2+rng.Intn(share+1))
+	}
+	p.Resources = append(p.Resources, r)
+}
+
+// AddConstraints ties n pairs of files together and keeps n other pairs
+// apart, no file is in more than one pair
+func (p *Puzzle) AddConstraints(rng *rand.Rand, n int) {
+	order := rng.Perm(len(p.Files))
+	for i := 0; i+1 < len(order) && i/2 < 2*n; i += 2 {
+		kind := DEPENDS
+		if i/2%2 == 1 {
+			kind = CONFLICTS
+		}
+		p.Constraints = append(p.Constraints, Constraint{
+			Kind:  kind,
+			Files: [2]string{p.Files[order[i]].Filename, p.Files[order[i+1]].Filename},
+		})
+	}
+}
+
+// AddClearances files every file under one of the departments and clears
+// every agent for some of them. Each department has at least one agent
+// cleared for it, so every file can still reach Glenda through someone.
+func (p *Puzzle) AddClearances(rng *rand.Rand, all []string, difficulty int) {
+	agents := len(p.Capacities)
+	departments := make([]string, len(all))
+	copy(departments, all)
+	ShuffleStrings(departments, rng)
+	if agents < len(departments) {
+		departments = departments[:agents]
+	}
+
+	p.Clearances = make([][]string, agents)
+	for i := range p.Clearances {
+		for k, d := range departments {
+			if k == i%len(departments) || rng.Float64() < CLEARANCE_CHANCE[difficulty] {
+				p.Clearances[i] = append(p.Clearances[i], d)
+			}
+		}
+	}
+	for i := range p.Files {
+		p.Files[i].Clearance = departments[rng.Intn(len(departments))]
+	}
+}
+
+// Cleared reports whether clearances let an agent send f to Glenda
+func Cleared(clearances []string, f File) bool {
+	return knapsack.Cleared(clearances, f.Item())
+}
+
+// Score is the secrecy of the files Glenda received, leaving out the ones
+// still waiting on the file they depend on
+func (p Puzzle) Score(received []File) int {
+	sent := make(map[string]bool)
+	for _, f := range received {
+		sent[f.Filename] = true
+	}
+	score := 0
+	for _, f := range received {
+		counts := true
+		for _, c := range p.Constraints {
+			if c.Kind == DEPENDS && c.Partner(f.Filename) != "" && !sent[c.Partner(f.Filename)] {
+				counts = false
+			}
+		}
+		if counts {
+			score += f.Secrecy
+		}
+	}
+	return score
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A scenario pack dresses the engine up for a different story: the NPC the
+// team sends files to, the files they steal and the numbers of the puzzle.
+// Each pack is a directory under scenarios/ with a scenario.json, messages
+// that replace the default ones in locale/[lang].json, and the NPC's script
+// in dialogue.json with translations in dialogue.[lang].json. Packs without
+// a script use Glenda's. Game creators can add packs by pointing
+// SCENARIO_DIR at a directory laid out like scenarios/.
+
+//go:embed scenarios
+var scenarioFiles embed.FS
+
+// The scenario the default messages and Glenda's script are written for
+const BASE_SCENARIO string = "office"
+
+// Scenario games get until their owner picks one with /scenario. Set with
+// -scenario.
+var DefaultScenario string = BASE_SCENARIO
+
+// The textbook puzzle deals this many files
+const MIN_FILENAMES int = 10
+
+type Scenario struct {
+	Name        string             `json:"-"` // The pack's directory
+	NPC         string             `json:"npc"`
+	Filenames   []string           `json:"filenames"`
+	Departments []string           `json:"departments"`
+	Durations   map[string]int     `json:"durations"` // Seconds for each difficulty
+	Tightness   map[string]float64 `json:"tightness"` // Share of the total file size the team can send
+	Sizes       [2]int             `json:"sizes"`     // Smallest and largest file in KB
+	Secrecy     [2]int             `json:"secrecy"`   // Least and most secret file
+
+	Catalogs  map[string]*Catalog  `json:"-"`
+	Dialogue  *Dialogue            `json:"-"`
+	Dialogues map[string]*Dialogue `json:"-"` // Translations of Dialogue
+	durations map[int]time.Duration
+	tightness map[int]float64
+}
+
+var Scenarios map[string]*Scenario = MustLoadScenarios()
+
+func MustLoadScenarios() map[string]*Scenario {
+	scenarios := make(map[string]*Scenario)
+	packs, err := fs.Sub(scenarioFiles, "scenarios")
+	if err != nil {
+		panic(fmt.Sprintf("invalid scenarios: %s", err.Error()))
+	}
+	names, err := PackNames(packs)
+	if err != nil {
+		panic(fmt.Sprintf("invalid scenarios: %s", err.Error()))
+	}
+	for _, name := range names {
+		s, err := LoadScenario(packs, name)
+		if err != nil {
+			panic(fmt.Sprintf("invalid scenario %s: %s", name, err.Error()))
+		}
+		scenarios[name] = s
+	}
+
+	dir := os.Getenv("SCENARIO_DIR")
+	if dir == "" {
+		return scenarios
+	}
+	packs = os.DirFS(dir)
+	names, err = PackNames(packs)
+	if err != nil {
+		log.Printf("Error listing scenarios in %s: %s", dir, err.Error())
+		return scenarios
+	}
+	for _, name := range names {
+		s, err := LoadScenario(packs, name)
+		if err != nil {
+			log.Printf("Error loading scenario %s, skipping it: %s", name, err.Error())
+			continue
+		}
+		scenarios[name] = s
+	}
+	return scenarios
+}
+
+// PackNames lists the directories in packs that hold a scenario.json
+func PackNames(packs fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(packs, ".")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if _, err := fs.Stat(packs, path.Join(entry.Name(), "scenario.json")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// LoadScenario reads the pack in the directory name of packs
+func LoadScenario(packs fs.FS, name string) (*Scenario, error) {
+	data, err := fs.ReadFile(packs, path.Join(name, "scenario.json"))
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{Name: name}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	overlays := make(map[string]*Catalog)
+	paths, err := fs.Glob(packs, path.Join(name, "locale", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		data, err := fs.ReadFile(packs, p)
+		if err != nil {
+			return nil, err
+		}
+		cat, err := ParseCatalog(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", p, err.Error())
+		}
+		overlays[cat.Lang] = cat
+	}
+	s.mergeCatalogs(overlays)
+
+	if err := s.loadDialogues(packs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Scenario) check() error {
+	if s.NPC == "" {
+		return errors.New("missing npc")
+	}
+	if len(s.Filenames) < MIN_FILENAMES {
+		return fmt.Errorf("needs at least %d filenames", MIN_FILENAMES)
+	}
+	if len(s.Departments) == 0 {
+		return errors.New("missing departments")
+	}
+
+	s.durations = make(map[int]time.Duration)
+	for name, seconds := range s.Durations {
+		difficulty, err := ParseDifficulty(name)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid duration %s: %d", name, seconds)
+		}
+		s.durations[difficulty] = time.Duration(seconds) * time.Second
+	}
+	s.tightness = make(map[int]float64)
+	for name, share := range s.Tightness {
+		difficulty, err := ParseDifficulty(name)
+		if err != nil || share <= 0 || share > 1 {
+			return fmt.Errorf("invalid tightness %s: %g", name, share)
+		}
+		s.tightness[difficulty] = share
+	}
+
+	if s.Sizes == [2]int{} {
+		s.Sizes = [2]int{20, 90}
+	}
+	if s.Secrecy == [2]int{} {
+		s.Secrecy = [2]int{40, 100}
+	}
+	if s.Sizes[0] < 1 || s.Sizes[1] < s.Sizes[0] {
+		return fmt.Errorf("invalid sizes %v", s.Sizes)
+	}
+	if s.Secrecy[0] < 1 || s.Secrecy[1] < s.Secrecy[0] {
+		return fmt.Errorf("invalid secrecy %v", s.Secrecy)
+	}
+	return nil
+}
+
+// mergeCatalogs lays the pack's messages over every catalog. Languages the
+// pack wasn't translated to get its English messages, so the story holds
+// together.
+func (s *Scenario) mergeCatalogs(overlays map[string]*Catalog) {
+	if len(overlays) == 0 {
+		s.Catalogs = Catalogs
+		return
+	}
+	s.Catalogs = make(map[string]*Catalog)
+	for lang, base := range Catalogs {
+		cat := &Catalog{Lang: base.Lang, Name: base.Name, Messages: make(map[string]string)}
+		for k, v := range base.Messages {
+			cat.Messages[k] = v
+		}
+		overlay, ok := overlays[lang]
+		if !ok {
+			overlay, ok = overlays[SOURCE_LANG]
+		}
+		if ok {
+			for k, v := range overlay.Messages {
+				cat.Messages[k] = v
+			}
+		}
+		s.Catalogs[lang] = cat
+	}
+}
+
+func (s *Scenario) loadDialogues(packs fs.FS) error {
+	data, err := fs.ReadFile(packs, path.Join(s.Name, "dialogue.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		if s.NPC != GlendaDialogue.NPC {
+			return fmt.Errorf("%s needs a dialogue.json", s.NPC)
+		}
+		s.Dialogue = GlendaDialogue
+		s.Dialogues = GlendaDialogues
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.Dialogue, err = ParseDialogue(data); err != nil {
+		return fmt.Errorf("dialogue.json: %s", err.Error())
+	}
+	s.Dialogue.NPC = s.NPC
+	s.Dialogues = make(map[string]*Dialogue)
+	paths, err := fs.Glob(packs, path.Join(s.Name, "dialogue.*.json"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		lang := strings.TrimSuffix(strings.TrimPrefix(path.Base(p), "dialogue."), ".json")
+		translation, err := fs.ReadFile(packs, p)
+		if err != nil {
+			return err
+		}
+		// Parsed again so the translation doesn't change the original
+		d, err := ParseDialogue(data)
+		if err != nil {
+			return err
+		}
+		other, err := ParseDialogue(translation)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p, err.Error())
+		}
+		d.Merge(other)
+		d.NPC = s.NPC
+		s.Dialogues[lang] = d
+	}
+	return nil
+}
+
+// FindScenario returns the scenario called name, or the default one
+func FindScenario(name string) *Scenario {
+	if s, ok := Scenarios[name]; ok {
+		return s
+	}
+	if s, ok := Scenarios[DefaultScenario]; ok {
+		return s
+	}
+	return Scenarios[BASE_SCENARIO]
+}
+
+// ScenarioNames returns the name of every scenario in order
+func ScenarioNames() []string {
+	names := make([]string, 0, len(Scenarios))
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsNPC reports whether name belongs to the NPC of any scenario, players
+// can't take it
+func IsNPC(name string) bool {
+	for _, s := range Scenarios {
+		if s.NPC == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog is the pack's messages in lang, or the default language
+func (s *Scenario) Catalog(lang string) *Catalog {
+	if cat, ok := s.Catalogs[lang]; ok {
+		return cat
+	}
+	if cat, ok := s.Catalogs[DefaultLang]; ok {
+		return cat
+	}
+	return s.Catalogs[SOURCE_LANG]
+}
+
+func (s *Scenario) Duration(difficulty int) time.Duration {
+	if d, ok := s.durations[difficulty]; ok {
+		return d
+	}
+	return MISSION_DURATIONS[difficulty]
+}
+
+// Share is how much of the total file size the team can send
+func (s *Scenario) Share(difficulty int) float64 {
+	if t, ok := s.tightness[difficulty]; ok {
+		return t
+	}
+	return PUZZLE_TIGHTNESS[difficulty]
+}
+
+// NPC is who the team sends files to
+func (g *Game) NPC() string {
+	return g.Scenario.NPC
+}
+
+// SetScenario must be called before the mission starts
+func (g *Game) SetScenario(s *Scenario) {
+	g.Scenario = s
+	g.Glenda = s.Dialogue
+	if g.Mission == nil {
+		g.SetDifficulty(g.Difficulty)
+	}
+}
+
+// PickScenario lists the scenarios, or lets the game owner pick one in the
+// lobby
+func (c *Client) PickScenario(name string) {
+	g := c.Game
+	if name == "" {
+		text := c.Tr("scenario.current", T("scenario.title"), g.Scenario.Name)
+		for _, n := range ScenarioNames() {
+			text += c.Tr("scenario.available", n, Scenarios[n].Catalog(c.Lang).Text("scenario.title"))
+		}
+		text += c.Tr("scenario.pick")
+		c.MsgCh <- Message{Text: text}
+		return
+	}
+
+	s, ok := Scenarios[strings.ToLower(name)]
+	if !ok {
+		c.Tell("scenario.unknown", name)
+		return
+	}
+	if c.Name != g.Owner {
+		c.Tell("scenario.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	if g.Building != nil {
+		c.Tell("scenario.has_rival")
+		return
+	}
+	g.SetScenario(s)
+	g.MsgAll("scenario.picked", c.Name, T("scenario.title"))
+	g.MsgAll(INTRO_MSG)
+}
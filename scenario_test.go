@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestScenarioPacks(t *testing.T) {
+	source := Catalogs[SOURCE_LANG]
+	for _, name := range ScenarioNames() {
+		s := Scenarios[name]
+		for _, lang := range Langs() {
+			cat := s.Catalog(lang)
+			if cat.Lang != lang {
+				t.Errorf("%s: no %s catalog", name, lang)
+			}
+			for key, template := range cat.Messages {
+				if _, ok := source.Messages[key]; !ok {
+					t.Errorf("%s: %s isn't in the %s catalog", name, key, SOURCE_LANG)
+				} else if verbs(template) != verbs(source.Messages[key]) {
+					t.Errorf("%s: %s %s has verbs %q, want %q", name, lang, key, verbs(template), verbs(source.Messages[key]))
+				}
+				if s.NPC != GlendaDialogue.NPC && strings.Contains(template, GlendaDialogue.NPC) {
+					t.Errorf("%s: %s %s still mentions %s", name, lang, key, GlendaDialogue.NPC)
+				}
+			}
+			if _, ok := s.Dialogues[lang]; !ok && lang != SOURCE_LANG {
+				t.Errorf("%s: no %s dialogue", name, lang)
+			}
+		}
+		if s.Dialogue.NPC != s.NPC {
+			t.Errorf("%s: dialogue is for %s, not %s", name, s.Dialogue.NPC, s.NPC)
+		}
+
+		p := GeneratePuzzle(NewRand(1), s, 3, NORMAL)
+		for _, f := range p.Files {
+			if f.Size < s.Sizes[0] || f.Size > s.Sizes[1] || f.Secrecy < s.Secrecy[0] || f.Secrecy > s.Secrecy[1] {
+				t.Errorf("%s: %s is out of range with size %d and secrecy %d", name, f.Filename, f.Size, f.Secrecy)
+			}
+		}
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	packs := fstest.MapFS{
+		"mars/scenario.json": {Data: []byte(fmt.Sprintf(`{"npc": "Ares", "filenames": ["%s"], "departments": ["Ops"], "durations": {"hard": 30}}`,
+			strings.Join(Scenarios[BASE_SCENARIO].Filenames, `", "`)))},
+		"mars/locale/en.json": {Data: []byte(`{"lang": "en", "messages": {"scenario.title": "Mars Base"}}`)},
+		"mars/dialogue.json":  {Data: []byte(`{"fallback": ["Welcome to Mars, {{.Name}}."]}`)},
+		"moon/scenario.json":  {Data: []byte(`{"npc": "Selene", "filenames": ["a.txt"], "departments": ["Ops"]}`)},
+	}
+	s, err := LoadScenario(packs, "mars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Duration(HARD) != 30*time.Second || s.Duration(EASY) != MISSION_DURATIONS[EASY] {
+		t.Errorf("Expected 30s hard and the default easy, got %s and %s", s.Duration(HARD), s.Duration(EASY))
+	}
+	// Languages the pack leaves out get its English messages
+	if title := s.Catalog("es").Text("scenario.title"); title != "Mars Base" {
+		t.Errorf("Expected the English title, got %q", title)
+	}
+	if s.Dialogue.NPC != "Ares" {
+		t.Errorf("Expected the dialogue to be for Ares, got %s", s.Dialogue.NPC)
+	}
+	if _, err := LoadScenario(packs, "moon"); err == nil {
+		t.Error("Expected a pack with one file to be rejected")
+	}
+}
+
+func TestPickScenario(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	alice := s.Join(room, "alice")
+	alice.Run([]Step{
+		{Send: "/scenario", Expect: []string{"Scenario: The Office (office)", "station      Space Station"}},
+		{Send: "/scenario moon", Expect: []string{`Unknown scenario "moon"`}},
+		{Send: "/scenario station", Expect: []string{"alice picked the scenario Space Station", "Meridian Station"}},
+	})
+
+	nick := s.Connect()
+	nick.Expect(Tr(ROOM_MSG))
+	nick.Send(room)
+	nick.Expect(Tr(NICK_MSG))
+	nick.Run([]Step{{Send: "Juno", Expect: []string{"Invalid Username"}}})
+	nick.Close()
+
+	bob := s.Join(room, "bob")
+	bob.Expect("bob has joined")
+	carl := s.Join(room, "carl")
+	for _, p := range []*TestPlayer{alice, bob, carl} {
+		p.Expect("The whole crew is aboard")
+	}
+	_, files := alice.List()
+	alice.Run([]Step{
+		{Send: "/look", Expect: []string{"mission patches", "look -- | Juno"}},
+		{Send: "/send Juno " + files[0].Filename, Expect: []string{"Sent file: " + files[0].Filename}},
+		{Send: "/msg Juno hello", Expect: []string{"Juno | "}},
+	})
+	for _, p := range []*TestPlayer{alice, bob, carl} {
+		p.Send("/msg Juno done")
+	}
+	alice.Expect("Game ended")
+}
+
+func TestScenarioPuzzle(t *testing.T) {
+	g := NewGame("puzzle", RealClock{}, NewRand(TEST_SEED))
+	g.Scenario = FindScenario("station")
+	for _, name := range []string{"alice", "bob", "carl"} {
+		g.Clients[name] = &Client{Name: name}
+	}
+	for _, f := range g.NewPuzzle().Files {
+		if f.Size < g.Scenario.Sizes[0] || f.Size > g.Scenario.Sizes[1] || f.Secrecy < g.Scenario.Secrecy[0] || f.Secrecy > g.Scenario.Secrecy[1] {
+			t.Errorf("Expected sizes in %v and secrecy in %v, got %#v", g.Scenario.Sizes, g.Scenario.Secrecy, f)
+		}
+	}
+}
@@ -1,34 +1,95 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"strconv"
+	"time"
 )
 
 func main() {
+	loadGames := flag.Int("loadtest", 0, "run an in-process load test with this many games instead of serving")
+	loadConcurrency := flag.Int("loadtest-concurrency", 0, "games in flight at once during the load test, 0 for all")
+	loadRounds := flag.Int("loadtest-rounds", 3, "rounds of commands each load test player runs")
+	loadTCP := flag.Bool("loadtest-tcp", false, "connect load test players over loopback TCP instead of pipes")
+	seed := flag.Int64("seed", 0, "seed for puzzle generation, 0 picks one from the time")
+	spread := flag.Int("match-spread", 0, "only match quick play agents whose average percentage of optimal is this close, 0 matches anyone")
+	aiFill := flag.Duration("ai-fill", 0, "fill lobbies with AI agents after waiting this long for players, 0 never does")
+	lang := flag.String("lang", SOURCE_LANG, "language players get until they pick one with /lang")
+	scenario := flag.String("scenario", BASE_SCENARIO, "scenario games get until their owner picks one with /scenario")
+	telnet := flag.Bool("telnet", false, "negotiate telnet options with new connections, for colour and terminal widths; nc shows them as stray characters")
+	stats := flag.Bool("stats", false, "print every player's history, or one player's with their name as an argument, and exit")
+	flag.Parse()
+
+	if _, ok := Catalogs[*lang]; !ok {
+		fmt.Printf("No catalog for language %q, try one of %v\n", *lang, Langs())
+		os.Exit(1)
+	}
+	if _, ok := Scenarios[*scenario]; !ok {
+		fmt.Printf("No scenario %q, try one of %v\n", *scenario, ScenarioNames())
+		os.Exit(1)
+	}
+
+	if *stats {
+		DefaultLang = *lang
+		fmt.Print(PrintStats(Profiles, Accounts, flag.Arg(0)))
+		return
+	}
+
+	MatchSkillSpread = *spread
+	LobbyFillWait = *aiFill
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if *loadGames > 0 {
+		log.SetOutput(ioutil.Discard)
+		lt := NewLoadTest(*loadGames)
+		lt.Concurrency = *loadConcurrency
+		lt.Rounds = *loadRounds
+		lt.TCP = *loadTCP
+		lt.Seed = *seed
+		report, err := lt.Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(report)
+		return
+	}
+
+	// Set after the load test, its players read the default messages
+	DefaultLang = *lang
+	DefaultScenario = *scenario
+
 	InitLogger()
+	log.Printf("Using seed %d", *seed)
 
 	connChan := make(chan net.Conn, 100)
 	gameRequestCh := make(chan GameRequest, 100)
 
-	go ConnectionHandler(connChan, gameRequestCh)
-	go GameHandler(gameRequestCh)
+	stores := DefaultStores()
+	go ConnectionHandler(connChan, gameRequestCh, stores)
+	go GameHandler(gameRequestCh, RealClock{}, *seed, stores)
 
 	server := &Server{
-		Type: "tcp",
-		Host: "",
-		Port: 6000,
+		Type:   "tcp",
+		Host:   "",
+		Port:   6000,
+		Telnet: *telnet,
 	}
 	server.Run(connChan)
 }
 
 type Server struct {
-	Type string
-	Host string
-	Port int
+	Type   string
+	Host   string
+	Port   int
+	Telnet bool // Wrap connections in a TelnetConn
 }
 
 func (s *Server) Run(connChan chan net.Conn) {
@@ -43,10 +104,13 @@ func (s *Server) Run(connChan chan net.Conn) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			log.Printf("Error occurred accepting connection: %p", err.Error())
+			log.Printf("Error occurred accepting connection: %s", err.Error())
 			continue
 		}
 		log.Printf("New connection from %v", conn.RemoteAddr())
+		if s.Telnet {
+			conn = NewTelnetConn(conn)
+		}
 		connChan <- conn
 	}
 }
@@ -64,8 +128,8 @@ func InitLogger() {
 	f, err := os.OpenFile("sag.log", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
 		fmt.Printf("error opening file: %v", err)
+		return
 	}
-	defer f.Close()
 
 	log.SetOutput(f)
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"./knapsack"
+)
+
+// An agent that can send files to Glenda, Capacity is the bandwidth left
+type Agent = knapsack.Agent
+
+// Plan maps each agent name to the files they should send to Glenda
+type Plan map[string][]File
+
+type Solution struct {
+	Plan  Plan
+	Score int
+}
+
+// Owner returns the agent the plan sends filename through, or "" if the file
+// is left out
+func (p Plan) Owner(filename string) string {
+	for name, files := range p {
+		for _, f := range files {
+			if f.Filename == filename {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Solve finds the assignment of files to agents with the highest total
+// secrecy that fits every agent's capacity, the multiple knapsack problem.
+// Constraints on files not in files are ignored.
+func Solve(files []File, agents []Agent, constraints ...Constraint) Solution {
+	items := make([]knapsack.Item, len(files))
+	for i, f := range files {
+		items[i] = f.Item()
+	}
+	pairs := make([]knapsack.Pair, len(constraints))
+	for i, c := range constraints {
+		pairs[i] = knapsack.Pair{Kind: c.Kind, Items: c.Files}
+	}
+	solution := knapsack.Solve(items, agents, pairs...)
+
+	plan := make(Plan)
+	for _, a := range agents {
+		plan[a.Name] = make([]File, 0)
+	}
+	for i, a := range solution.Assign {
+		if a >= 0 {
+			name := agents[a].Name
+			plan[name] = append(plan[name], files[i])
+		}
+	}
+	return Solution{Plan: plan, Score: solution.Score}
+}
+
+// Item is f as the solver sees it
+func (f File) Item() knapsack.Item {
+	return knapsack.Item{Name: f.Filename, Size: f.Size, Value: f.Secrecy, Costs: f.Costs, Clearance: f.Clearance}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	files := GenerateFiles(NewRand(1), Scenarios[BASE_SCENARIO].Filenames)
+	agents := []Agent{{Name: "a", Capacity: 50}, {Name: "b", Capacity: 81}, {Name: "c", Capacity: 120}}
+
+	solution := Solve(files, agents)
+
+	score := 0
+	for _, a := range agents {
+		size := 0
+		for _, f := range solution.Plan[a.Name] {
+			size += f.Size
+			score += f.Secrecy
+		}
+		if size > a.Capacity {
+			t.Errorf("Agent %s over capacity: %d > %d", a.Name, size, a.Capacity)
+		}
+	}
+	if score != solution.Score {
+		t.Errorf("Plan scores %d, solution reports %d", score, solution.Score)
+	}
+	if expected := bruteForce(files, agents); solution.Score != expected {
+		t.Errorf("Expected score %d, got %d", expected, solution.Score)
+	}
+}
+
+func TestSolveNothingFits(t *testing.T) {
+	files := []File{{Filename: "big.txt", Size: 100, Secrecy: 100}}
+	solution := Solve(files, []Agent{{Name: "a", Capacity: 10}})
+	if solution.Score != 0 || len(solution.Plan["a"]) != 0 {
+		t.Errorf("Expected empty plan, got %#v", solution)
+	}
+}
+
+func bruteForce(files []File, agents []Agent) int {
+	best := 0
+	capacity := make([]int, len(agents))
+	for i, a := range agents {
+		capacity[i] = a.Capacity
+	}
+	var rec func(i int, score int)
+	rec = func(i int, score int) {
+		if i == len(files) {
+			if score > best {
+				best = score
+			}
+			return
+		}
+		rec(i+1, score)
+		for a := range capacity {
+			if capacity[a] >= files[i].Size {
+				capacity[a] -= files[i].Size
+				rec(i+1, score+files[i].Secrecy)
+				capacity[a] += files[i].Size
+			}
+		}
+	}
+	rec(0, 0)
+	return best
+}
+
+func TestSolveBudgets(t *testing.T) {
+	files := []File{
+		{Filename: "a.txt", Size: 10, Secrecy: 50, Costs: []int{4}},
+		{Filename: "b.txt", Size: 10, Secrecy: 40, Costs: []int{1}},
+		{Filename: "c.txt", Size: 10, Secrecy: 30, Costs: []int{1}},
+	}
+	// Bandwidth for all three, but the access log only fits b and c
+	solution := Solve(files, []Agent{{Name: "a", Capacity: 30, Budgets: []int{3}}})
+	if solution.Score != 70 {
+		t.Errorf("Expected score 70, got %d", solution.Score)
+	}
+	if solution.Plan.Owner("a.txt") != "" {
+		t.Errorf("Expected a.txt to be left out, got %#v", solution.Plan)
+	}
+}
+
+func TestSolveConstraints(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		rng := NewRand(seed)
+		p := GeneratePuzzle(rng, Scenarios[BASE_SCENARIO], 2, HARD)
+		p.AddConstraints(rng, 2)
+		agents := []Agent{{Name: "a", Capacity: p.Capacities[0]}, {Name: "b", Capacity: p.Capacities[1]}}
+
+		solution := Solve(p.Files, agents, p.Constraints...)
+		sent := append(solution.Plan["a"], solution.Plan["b"]...)
+		if score := p.Score(sent); score != solution.Score {
+			t.Errorf("Seed %d: plan scores %d, solution reports %d", seed, score, solution.Score)
+		}
+		if expected := bruteForceConstrained(p, agents); solution.Score != expected {
+			t.Errorf("Seed %d: expected score %d, got %d", seed, expected, solution.Score)
+		}
+	}
+}
+
+func bruteForceConstrained(p Puzzle, agents []Agent) int {
+	best := 0
+	capacity := make([]int, len(agents))
+	for i, a := range agents {
+		capacity[i] = a.Capacity
+	}
+	sent := make([]File, 0)
+	var rec func(i int)
+	rec = func(i int) {
+		if i == len(p.Files) {
+			for _, c := range p.Constraints {
+				if c.Kind == CONFLICTS && containsFile(sent, c.Files[0]) && containsFile(sent, c.Files[1]) {
+					return
+				}
+			}
+			if score := p.Score(sent); score > best {
+				best = score
+			}
+			return
+		}
+		rec(i + 1)
+		f := p.Files[i]
+		for a := range capacity {
+			if capacity[a] >= f.Size {
+				capacity[a] -= f.Size
+				sent = append(sent, f)
+				rec(i + 1)
+				sent = sent[:len(sent)-1]
+				capacity[a] += f.Size
+			}
+		}
+	}
+	rec(0)
+	return best
+}
+
+func containsFile(files []File, filename string) bool {
+	for _, f := range files {
+		if f.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSolveClearances(t *testing.T) {
+	files := []File{
+		{Filename: "payroll.xls", Size: 10, Secrecy: 50, Clearance: "Finance"},
+		{Filename: "org_chart.pdf", Size: 10, Secrecy: 40, Clearance: "HR"},
+	}
+	// Same bandwidth, but only b may send the payroll
+	agents := []Agent{
+		{Name: "a", Capacity: 10, Clearances: []string{"HR"}},
+		{Name: "b", Capacity: 10, Clearances: []string{"HR", "Finance"}},
+	}
+	solution := Solve(files, agents)
+	if solution.Score != 90 || solution.Plan.Owner("payroll.xls") != "b" {
+		t.Errorf("Expected b to send the payroll for 90, got %#v", solution)
+	}
+}
+
+func TestSolveHandoffs(t *testing.T) {
+	files := []File{
+		{Filename: "a.txt", Size: 10, Secrecy: 50},
+		{Filename: "b.txt", Size: 10, Secrecy: 40},
+		{Filename: "c.txt", Size: 10, Secrecy: 30},
+	}
+	// a holds everything but can only send one, and only pass one on
+	agents := []Agent{
+		{Name: "a", Capacity: 10, Holds: []string{"a.txt", "b.txt", "c.txt"}, Handoffs: 1},
+		{Name: "b", Capacity: 20},
+	}
+	if solution := Solve(files, agents); solution.Score != 90 {
+		t.Errorf("Expected score 90, got %#v", solution)
+	}
+}
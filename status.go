@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Status shows the mission dashboard. The game owner can hide or show the
+// teammates' bandwidth with "/status hide" and "/status show".
+func (c *Client) Status(arg string) {
+	g := c.Game
+	switch arg {
+	case "":
+	case "show", "hide":
+		if c.Name != g.Owner {
+			c.Tell("status.not_owner", g.Owner)
+			return
+		}
+		g.ShowBandwidth = arg == "show"
+		if g.ShowBandwidth {
+			g.MsgAll("status.shown", c.Name)
+		} else {
+			g.MsgAll("status.hidden", c.Name)
+		}
+		return
+	}
+	c.MsgCh <- Message{Text: g.StatusText(c)}
+}
+
+// StatusText renders the dashboard as seen by c
+func (g *Game) StatusText(c *Client) string {
+	text := c.Tr("status.mission", g.Name, g.Owner, DIFFICULTIES[g.Difficulty])
+	text += c.Tr("status.scenario", T("scenario.title"), g.Scenario.Name)
+	if g.Mission != nil {
+		text += c.Tr("status.campaign", g.Mission.Title(), g.Mission.Target)
+	}
+	if b := g.Building; b != nil {
+		b.mu.Lock()
+		if b.Limit > 0 {
+			text += c.Tr("status.rival_suspicion", b.Rival(g).Name, b.Suspicion, b.Limit)
+		} else {
+			text += c.Tr("status.rival", b.Rival(g).Name)
+		}
+		b.mu.Unlock()
+	}
+	switch g.Status {
+	case LOBBY:
+		text += c.Tr("status.waiting", len(g.Clients), g.TeamSize)
+	default:
+		text += c.Tr("status.running", int(g.TimeLeft().Seconds()), g.FinalScore(), g.HintsUsed, MAX_HINTS)
+	}
+
+	resources := g.Resources()
+	extra := ""
+	for _, r := range resources {
+		extra += fmt.Sprintf("  %12s", c.Tr(r.Name))
+	}
+	handoffs := g.Variants[HANDOFF_VARIANT]
+	if handoffs {
+		extra += fmt.Sprintf("  %9s", c.Tr("status.handoffs"))
+	}
+	extra += fmt.Sprintf("  %5s  %4s", c.Tr("status.files"), c.Tr("status.done"))
+	clients := g.SortedClients()
+	names := []string{c.Tr("status.agent")}
+	for _, client := range clients {
+		names = append(names, client.Name)
+	}
+	width := c.Column(names, utf8.RuneCountInString(c.Tr("status.header", 0, "", c.Tr("status.bandwidth"))+extra))
+	text += c.Tr("status.header", width, c.Tr("status.agent"), c.Tr("status.bandwidth")) + extra
+	if g.HasClearances() {
+		text += "  " + c.Tr("list.clearance_column")
+	}
+	text += "\n"
+	for _, client := range clients {
+		hidden := !g.ShowBandwidth && client != c
+		row := c.Tr("status.row", width, client.Name, c.Tr("status.kb", client.Bandwidth))
+		if hidden {
+			row = c.Tr("status.row", width, client.Name, c.Tr("status.hidden_value"))
+		}
+		for k := range resources {
+			if hidden {
+				row += fmt.Sprintf("  %12s", c.Tr("status.hidden_value"))
+			} else {
+				row += fmt.Sprintf("  %12d", client.Budgets[k])
+			}
+		}
+		if handoffs {
+			row += fmt.Sprintf("  %9d", client.Handoffs)
+		}
+		done := c.Tr("status.no")
+		if client.DoneSendingFiles {
+			done = c.Tr("status.yes")
+		}
+		text += row + fmt.Sprintf("  %5d  %4s", len(client.Files), done)
+		if g.HasClearances() {
+			text += "  " + strings.Join(client.Clearances, ", ")
+		}
+		text += "\n"
+	}
+	return text
+}
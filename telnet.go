@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Telnet commands and options, RFC 854 and friends
+const (
+	IAC  byte = 255
+	DONT byte = 254
+	DO   byte = 253
+	WONT byte = 252
+	WILL byte = 251
+	SB   byte = 250
+	SE   byte = 240
+
+	OPT_ECHO  byte = 1
+	OPT_SGA   byte = 3
+	OPT_TTYPE byte = 24
+	OPT_NAWS  byte = 31
+
+	TTYPE_IS   byte = 0
+	TTYPE_SEND byte = 1
+)
+
+// Width assumed for clients that don't tell theirs, nc among them
+const DEFAULT_WIDTH int = 80
+
+// Widest the first column of /list and /status gets
+const TABLE_COLUMN int = 20
+
+const (
+	ANSI_RESET   = "\x1b[0m"
+	ANSI_BOLD    = "\x1b[1m"
+	ANSI_RED     = "\x1b[31m"
+	ANSI_GREEN   = "\x1b[32m"
+	ANSI_YELLOW  = "\x1b[33m"
+	ANSI_BLUE    = "\x1b[34m"
+	ANSI_MAGENTA = "\x1b[35m"
+	ANSI_CYAN    = "\x1b[36m"
+)
+
+// Colours of the lines sent to terminals that can show them, by how the
+// lines start
+var CATEGORY_COLOURS = []struct {
+	Prefix string
+	Colour string
+}{
+	{"err -- |", ANSI_RED},
+	{"fail |", ANSI_BOLD + ANSI_RED},
+	{"send -- |", ANSI_GREEN},
+	{"list -- |", ANSI_CYAN},
+	{"* -- |", ANSI_YELLOW},
+	{"hint -- |", ANSI_MAGENTA},
+	{"versus -- |", ANSI_MAGENTA},
+}
+
+var chatLineRe = regexp.MustCompile(`^(\w+) \| `)
+
+// TelnetConn speaks enough telnet for the game: it keeps IAC sequences out
+// of what players type, learns the terminal's size and type, hides typed
+// passwords and colours what it sends. Clients that let the server echo
+// send every key as it is typed, and get their lines edited here. Clients
+// that never answer, like nc, only see the options asked for when they
+// connect.
+type TelnetConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	telnet    bool // The client answered, so it speaks telnet
+	editing   bool // The client sends keys, the editor echoes them
+	masked    bool // Typing a password
+	width     int
+	ttype     string
+	lineStart bool // The last write ended a line
+	editor    LineEditor
+
+	// Read state, only touched by the reading goroutine
+	buf   [512]byte
+	typed []byte // Text waiting for the reader
+	cmd   []byte // IAC sequence read so far
+	cr    bool   // The last byte read was a CR
+}
+
+func NewTelnetConn(conn net.Conn) *TelnetConn {
+	t := &TelnetConn{Conn: conn, lineStart: true}
+	t.command(DO, OPT_NAWS)
+	t.command(DO, OPT_TTYPE)
+	// Character at a time, if the client will have it
+	t.command(WILL, OPT_SGA)
+	t.command(WILL, OPT_ECHO)
+	return t
+}
+
+// Read returns what the player typed, answering the telnet commands in it.
+// Edited lines come one at a time, since readers make a new bufio.Reader
+// for each line.
+func (t *TelnetConn) Read(p []byte) (int, error) {
+	for {
+		if len(t.typed) > 0 {
+			end := bytes.IndexByte(t.typed, '\n') + 1
+			if end == 0 {
+				end = len(t.typed)
+			}
+			n := copy(p, t.typed[:end])
+			t.typed = t.typed[n:]
+			return n, nil
+		}
+		n, err := t.Conn.Read(t.buf[:])
+		for _, b := range t.buf[:n] {
+			if t.filter(b) {
+				t.key(b)
+			}
+		}
+		// Don't hand a reader zero bytes for a packet of commands
+		if len(t.typed) == 0 && err != nil {
+			return 0, err
+		}
+	}
+}
+
+// key passes text through, or to the editor in character mode
+func (t *TelnetConn) key(b byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.editing {
+		t.typed = append(t.typed, b)
+		return
+	}
+	echo, line, done := t.editor.Key(b)
+	if echo != "" {
+		t.Conn.Write([]byte(echo))
+	}
+	if done {
+		t.typed = append(t.typed, line+"\n"...)
+		t.lineStart = true
+	}
+}
+
+// Complete sets what tab completes the word before the cursor with
+func (t *TelnetConn) Complete(complete func(line string) []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.editor.Complete = complete
+}
+
+// filter takes one byte read and reports whether it is text
+func (t *TelnetConn) filter(b byte) bool {
+	if len(t.cmd) == 0 {
+		if b == IAC {
+			t.cmd = append(t.cmd, b)
+			return false
+		}
+		// Telnet ends lines with CR NUL in character mode
+		cr := t.cr
+		t.cr = b == '\r'
+		return !(cr && b == 0)
+	}
+
+	t.cmd = append(t.cmd, b)
+	cmd := t.cmd
+	switch {
+	case len(cmd) == 2 && cmd[1] == IAC:
+		// An escaped 255, never part of what players type
+		t.cmd = t.cmd[:0]
+	case len(cmd) == 2 && cmd[1] >= WILL && cmd[1] <= DONT, len(cmd) == 2 && cmd[1] == SB:
+		// Wait for the option
+	case len(cmd) == 2:
+		// NOP, GA, AYT and the like
+		t.cmd = t.cmd[:0]
+	case cmd[1] != SB:
+		t.negotiate(cmd[1], cmd[2])
+		t.cmd = t.cmd[:0]
+	case cmd[len(cmd)-2] == IAC && b == SE:
+		t.subnegotiate(bytes.Replace(cmd[2:len(cmd)-2], []byte{IAC, IAC}, []byte{IAC}, -1))
+		t.cmd = t.cmd[:0]
+	case len(cmd) > 256:
+		// Nothing we ask for is that long
+		t.cmd = t.cmd[:0]
+	}
+	return false
+}
+
+func (t *TelnetConn) negotiate(verb byte, option byte) {
+	t.mu.Lock()
+	t.telnet = true
+	masked := t.masked
+	t.mu.Unlock()
+	switch {
+	case verb == WILL && option == OPT_TTYPE:
+		t.Send([]byte{IAC, SB, OPT_TTYPE, TTYPE_SEND, IAC, SE})
+	case verb == WILL && option == OPT_NAWS:
+		// Asked for when connecting, the size follows
+	case verb == WILL && option == OPT_SGA:
+		t.command(DO, option)
+	case verb == WILL:
+		// Line mode and the rest stay off
+		t.command(DONT, option)
+	case verb == DO && option == OPT_ECHO && !masked:
+		// Offered when connecting, the client now sends keys as typed
+		t.mu.Lock()
+		t.editing = true
+		t.mu.Unlock()
+	case verb == DONT && option == OPT_ECHO:
+		// The client edits lines itself
+		t.mu.Lock()
+		t.editing = false
+		t.mu.Unlock()
+	case verb == DO && (option == OPT_SGA || option == OPT_ECHO):
+		// Offered when connecting, or around passwords
+	case verb == DO:
+		t.command(WONT, option)
+	}
+}
+
+func (t *TelnetConn) subnegotiate(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case data[0] == OPT_NAWS && len(data) == 5:
+		t.width = int(data[1])<<8 | int(data[2])
+	case data[0] == OPT_TTYPE && len(data) > 1 && data[1] == TTYPE_IS:
+		t.ttype = strings.ToLower(string(data[2:]))
+	}
+}
+
+func (t *TelnetConn) command(verb byte, option byte) {
+	t.Send([]byte{IAC, verb, option})
+}
+
+// Send writes bytes as they are, for telnet commands
+func (t *TelnetConn) Send(b []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.Conn.Write(b)
+	return err
+}
+
+// Write sends text, with CR LF line ends and colour when the client is a
+// telnet terminal
+func (t *TelnetConn) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.telnet {
+		return t.Conn.Write(p)
+	}
+	colour := t.colour()
+	var out bytes.Buffer
+	// Move what the player is typing out of the way
+	redraw := t.editing && t.lineStart
+	if redraw {
+		out.WriteString(t.editor.Clear())
+	}
+	text := string(p)
+	for len(text) > 0 {
+		line, end := text, ""
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			line, end = strings.TrimSuffix(text[:i], "\r"), "\r\n"
+			text = text[i+1:]
+		} else {
+			text = ""
+		}
+		if colour && t.lineStart {
+			line = Colourise(line)
+		}
+		out.WriteString(line + end)
+		t.lineStart = end != ""
+	}
+	if redraw && t.lineStart {
+		out.WriteString(t.editor.Draw())
+	}
+	if _, err := t.Conn.Write(bytes.Replace(out.Bytes(), []byte{IAC}, []byte{IAC, IAC}, -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *TelnetConn) colour() bool {
+	return t.ttype != "" && t.ttype != "dumb" && t.ttype != "unknown"
+}
+
+// Width is how many columns the client's terminal has
+func (t *TelnetConn) Width() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.width <= 0 {
+		return DEFAULT_WIDTH
+	}
+	return t.width
+}
+
+// Echo turns the client's own echo back on, or off while typing a password
+func (t *TelnetConn) Echo(on bool) {
+	t.mu.Lock()
+	telnet, editing := t.telnet, t.editing
+	t.masked = !on
+	t.editor.Masked = !on
+	t.mu.Unlock()
+	if !telnet || editing {
+		return
+	}
+	if on {
+		t.command(WONT, OPT_ECHO)
+		// The enter typed after the password wasn't echoed
+		t.Write([]byte("\n"))
+	} else {
+		t.command(WILL, OPT_ECHO)
+	}
+}
+
+// Colourise wraps line in the colour of its category
+func Colourise(line string) string {
+	for _, c := range CATEGORY_COLOURS {
+		if strings.HasPrefix(line, c.Prefix) {
+			return c.Colour + line + ANSI_RESET
+		}
+	}
+	if m := chatLineRe.FindStringSubmatch(line); m != nil {
+		return ANSI_BOLD + ANSI_BLUE + m[1] + ANSI_RESET + line[len(m[1]):]
+	}
+	return line
+}
+
+// Width is how wide the client's terminal is
+func (c *Client) Width() int {
+	if t, ok := c.RWC.(*TelnetConn); ok {
+		return t.Width()
+	}
+	return DEFAULT_WIDTH
+}
+
+// Echo shows or hides what the client types, when their terminal lets us
+func (c *Client) Echo(on bool) {
+	if t, ok := c.RWC.(*TelnetConn); ok {
+		t.Echo(on)
+	}
+}
+
+// Column is how wide to make a table's first column holding cells, when
+// the rest of the table's lines take up rest columns
+func (c *Client) Column(cells []string, rest int) int {
+	longest := 0
+	for _, cell := range cells {
+		if n := utf8.RuneCountInString(cell); n > longest {
+			longest = n
+		}
+	}
+	width := c.Width() - rest
+	if width > TABLE_COLUMN {
+		width = TABLE_COLUMN
+	}
+	if width < longest {
+		width = longest
+	}
+	return width
+}
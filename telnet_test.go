@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTelnet(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	client, server := net.Pipe()
+	alice := &TestPlayer{t: t, Name: "alice", conn: client, lines: make(chan string, 100)}
+	go alice.read()
+	s.connCh <- NewTelnetConn(server)
+
+	alice.Expect(string([]byte{IAC, DO, OPT_NAWS, IAC, DO, OPT_TTYPE}))
+	alice.Expect(Tr(ROOM_MSG))
+	// A 40 column xterm
+	naws := []byte{IAC, WILL, OPT_NAWS, IAC, SB, OPT_NAWS, 0, 40, 0, 24, IAC, SE, IAC, WILL, OPT_TTYPE}
+	io.WriteString(client, string(naws)+room+"\r\n")
+	alice.Expect(string([]byte{IAC, SB, OPT_TTYPE, TTYPE_SEND, IAC, SE}) + Tr(NICK_MSG))
+	// It edits lines itself
+	ttype := []byte{IAC, SB, OPT_TTYPE, TTYPE_IS, 'X', 'T', 'E', 'R', 'M', IAC, SE, IAC, DONT, OPT_ECHO}
+	io.WriteString(client, string(ttype)+"alice\r\n")
+
+	bob := s.Join(room, "bob")
+	carl := s.Join(room, "carl")
+	for _, p := range []*TestPlayer{alice, bob, carl} {
+		p.Expect("mission starting")
+	}
+
+	// Commands in between the text are dropped
+	io.WriteString(client, "/li"+string([]byte{IAC, 241})+"st\r\n")
+	header := alice.Expect(ANSI_CYAN + "list -- | ")
+	if !strings.HasSuffix(header, ANSI_RESET+"\r") {
+		t.Errorf("Expected a coloured line ending in CR LF, got %q", header)
+	}
+	alice.Send("/bogus")
+	alice.Expect(ANSI_RED + "err -- |")
+	bob.Send("/msg alice hi")
+	alice.Expect(ANSI_BOLD + ANSI_BLUE + "bob" + ANSI_RESET + " | hi")
+}
+
+func TestColumn(t *testing.T) {
+	c := NewClient(&TelnetConn{width: 40})
+	cells := []string{"Filename", "memo.docx"}
+	if width := c.Column(cells, 35); width != 9 {
+		t.Errorf("Expected the longest cell on 40 columns, got %d", width)
+	}
+	if width := c.Column(cells, 25); width != 15 {
+		t.Errorf("Expected what is left of 40 columns, got %d", width)
+	}
+	if width := NewClient(&TelnetConn{}).Column(cells, 35); width != TABLE_COLUMN {
+		t.Errorf("Expected %d without a width, got %d", TABLE_COLUMN, width)
+	}
+}
+
+func TestCharacterMode(t *testing.T) {
+	s := NewTestServer(t)
+	room := s.Room()
+	client, server := net.Pipe()
+	alice := &TestPlayer{t: t, Name: "alice", conn: client, lines: make(chan string, 100)}
+	go alice.read()
+	s.connCh <- NewTelnetConn(server)
+
+	alice.Expect(string([]byte{IAC, WILL, OPT_SGA, IAC, WILL, OPT_ECHO}))
+	// Keys as they are typed, with a typo rubbed out
+	io.WriteString(client, string([]byte{IAC, DO, OPT_SGA, IAC, DO, OPT_ECHO})+room+"x\x7f\r\x00")
+	alice.Expect("\r\x1b[K" + room)
+	alice.Expect(Tr(NICK_MSG))
+	io.WriteString(client, "lice\x01a\r\x00")
+	alice.Expect("\x1b[4D")
+
+	bob := s.Join(room, "bob")
+	carl := s.Join(room, "carl")
+	for _, p := range []*TestPlayer{alice, bob, carl} {
+		p.Expect("mission starting")
+	}
+
+	// Find the smallest file to send
+	io.WriteString(client, "/li\t\r\x00/msg alice listed\r\x00")
+	alice.Expect("\x1b[K/list ")
+	name, size := "", 0
+	for line := range alice.lines {
+		if strings.Contains(line, "alice | listed") {
+			break
+		}
+		if m := listFileRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			if n, _ := strconv.Atoi(m[2]); name == "" || n < size {
+				name, size = m[1], n
+			}
+		}
+	}
+	if name == "" {
+		t.Fatalf("Expected alice's files listed")
+	}
+
+	io.WriteString(client, "/send b\t"+name[:len(name)-2]+"\t\r\x00")
+	alice.Expect("\x1b[K/send bob " + name + " ")
+	bob.Expect("Received file: " + name)
+
+	// Up brings the last line back, and lines typed meanwhile are redrawn
+	io.WriteString(client, "\x1b[A")
+	bob.Send("/msg alice hi")
+	alice.Expect("bob | hi")
+	io.WriteString(client, "\r\x00")
+	alice.Expect("/send bob " + name)
+}
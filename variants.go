@@ -0,0 +1,80 @@
+package main
+
+// Optional rules the game owner can switch on in the lobby. Players type
+// the name, the description is a message key.
+type Variant struct {
+	Name        string
+	Description string
+}
+
+const (
+	ACCESS_LOG_VARIANT   = "accesslog"
+	LINKED_FILES_VARIANT = "linked"
+	CLEARANCE_VARIANT    = "clearance"
+	HANDOFF_VARIANT      = "handoffs"
+)
+
+var VARIANTS = []Variant{
+	{ACCESS_LOG_VARIANT, "variant.accesslog"},
+	{LINKED_FILES_VARIANT, "variant.linked"},
+	{CLEARANCE_VARIANT, "variant.clearance"},
+	{HANDOFF_VARIANT, "variant.handoffs"},
+}
+
+// Files each agent can pass to teammates in the handoffs variant
+var HANDOFFS = map[int]int{
+	EASY:   4,
+	NORMAL: 3,
+	HARD:   2,
+}
+
+func FindVariant(name string) *Variant {
+	for i, v := range VARIANTS {
+		if v.Name == name {
+			return &VARIANTS[i]
+		}
+	}
+	return nil
+}
+
+// Mode lists the variants, or lets the owner turn one on or off in the lobby
+func (c *Client) Mode(name string, arg string) {
+	g := c.Game
+	if name == "" {
+		text := c.Tr("mode.list")
+		for _, v := range VARIANTS {
+			state := T("mode.off")
+			if g.Variants[v.Name] {
+				state = T("mode.on")
+			}
+			text += c.Tr("mode.variant", v.Name, state, T(v.Description))
+		}
+		c.MsgCh <- Message{Text: text}
+		return
+	}
+
+	v := FindVariant(name)
+	if v == nil {
+		c.Tell("mode.unknown", name)
+		return
+	}
+	if c.Name != g.Owner {
+		c.Tell("mode.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	if g.Building != nil {
+		c.Tell("versus.same_rules")
+		return
+	}
+	if arg == "off" {
+		delete(g.Variants, v.Name)
+		g.MsgAll("mode.turned_off", c.Name, v.Name)
+		return
+	}
+	g.Variants[v.Name] = true
+	g.MsgAll("mode.turned_on", c.Name, v.Name, T(v.Description))
+}
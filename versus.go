@@ -0,0 +1,461 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// A Building is where rival teams play a versus match. The teams are dealt
+// the same files and share one Glenda, whoever gets a file to her first keeps
+// it. With a suspicion limit, every file sent raises the building's
+// suspicion and the team that goes over the limit is caught. Each team only
+// touches the others on their own goroutines, through Post.
+type Building struct {
+	Teams     []*Game
+	Puzzle    Puzzle
+	Suspicion int
+	Limit     int // 0 for no limit
+	Lockdown  bool
+
+	mu       sync.Mutex
+	claimed  map[string]*Game
+	full     map[*Game]bool
+	started  bool
+	off      bool // Called off before the match started
+	finished map[*Game]bool
+}
+
+// A Challenge waits for the other team's owner to accept it
+type Challenge struct {
+	From  *Game
+	Limit int
+}
+
+// Challenges waiting between the rooms of one server, by the name of the
+// room challenged
+type Challenges struct {
+	mu sync.Mutex
+	to map[string]Challenge
+}
+
+func NewChallenges() *Challenges {
+	return &Challenges{to: make(map[string]Challenge)}
+}
+
+// Accept takes the challenge room sent g, or challenges room if it sent none
+func (cs *Challenges) Accept(g *Game, room string, limit int) (Challenge, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	challenge, ok := cs.to[g.Name]
+	if !ok || challenge.From.Name != room {
+		cs.to[room] = Challenge{From: g, Limit: limit}
+		return Challenge{}, false
+	}
+	delete(cs.to, g.Name)
+	return challenge, true
+}
+
+// Withdraw drops the challenges g sent and the ones sent to its room
+func (cs *Challenges) Withdraw(g *Game) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.to, g.Name)
+	for room, challenge := range cs.to {
+		if challenge.From == g {
+			delete(cs.to, room)
+		}
+	}
+}
+
+// Of returns the room that challenged g, "" for none, and the rooms g
+// challenged
+func (cs *Challenges) Of(g *Game) (string, []string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	from := ""
+	if challenge, ok := cs.to[g.Name]; ok {
+		from = challenge.From.Name
+	}
+	rooms := make([]string, 0)
+	for room, challenge := range cs.to {
+		if challenge.From == g {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+	return from, rooms
+}
+
+func NewBuilding(teams []*Game, limit int) *Building {
+	return &Building{
+		Teams:    teams,
+		Limit:    limit,
+		claimed:  make(map[string]*Game),
+		full:     make(map[*Game]bool),
+		finished: make(map[*Game]bool),
+	}
+}
+
+// Versus shows the rivalry, or lets the game owner challenge another room,
+// accept its challenge or call it off in the lobby
+func (c *Client) Versus(room string, limit string) {
+	g := c.Game
+	if room == "" {
+		c.MsgCh <- Message{Text: g.VersusText(c)}
+		return
+	}
+	if c.Name != g.Owner {
+		c.Tell("versus.not_owner", g.Owner)
+		return
+	}
+	if g.Status != LOBBY {
+		c.Tell("err.started")
+		return
+	}
+	if room == "off" {
+		g.CallOff()
+		return
+	}
+	if room == g.Name {
+		c.Tell("versus.self")
+		return
+	}
+	if g.Mission != nil {
+		c.Tell("versus.campaign")
+		return
+	}
+	if g.Building != nil {
+		c.Tell("versus.has_rival")
+		return
+	}
+	// The command only lets whole numbers above 0 through
+	n, _ := strconv.Atoi(limit)
+
+	challenge, ok := g.Challenges.Accept(g, room, n)
+	if !ok {
+		g.MsgAll("versus.challenged", c.Name, room, g.Name)
+		return
+	}
+
+	// The rival checks it is still waiting and plays by the same rules on
+	// its own goroutine, until then the building keeps this team from
+	// starting alone
+	rival := challenge.From
+	b := NewBuilding([]*Game{rival, g}, challenge.Limit)
+	g.Building = b
+	rules := g.Rules()
+	rival.Post(func() { rival.Link(b, c, rules) }, func() {
+		g.Post(func() { g.Unlink(b, c, "versus.not_waiting", room) }, nil)
+	})
+}
+
+// Rules are the settings rival teams have to agree on, the building deals
+// one puzzle for both
+type Rules struct {
+	TeamSize   int
+	Scenario   *Scenario
+	Difficulty int
+	Modes      string
+}
+
+func (g *Game) Rules() Rules {
+	return Rules{TeamSize: g.TeamSize, Scenario: g.Scenario, Difficulty: g.Difficulty, Modes: g.Modes()}
+}
+
+// Modes lists the variants switched on, in the order /mode shows them, ""
+// for none
+func (g *Game) Modes() string {
+	modes := ""
+	for _, v := range VARIANTS {
+		if g.Variants[v.Name] {
+			if modes != "" {
+				modes += ", "
+			}
+			modes += v.Name
+		}
+	}
+	return modes
+}
+
+// ModesText is modes to show a player
+func ModesText(modes string) interface{} {
+	if modes == "" {
+		return T("mode.none")
+	}
+	return modes
+}
+
+// Link makes the team a rival in b, which the owner c of the other team
+// accepted with their rules, if it is still waiting for one and plays by
+// the same ones
+func (g *Game) Link(b *Building, c *Client, rules Rules) {
+	b.mu.Lock()
+	off := b.off
+	b.mu.Unlock()
+	if off {
+		return
+	}
+	other := b.Rival(g)
+	refuse := func(key string, args ...interface{}) {
+		other.Post(func() { other.Unlink(b, c, key, args...) }, nil)
+	}
+	switch {
+	case g.Status != LOBBY || g.Building != nil || g.Mission != nil:
+		refuse("versus.not_waiting", g.Name)
+		return
+	case g.TeamSize != rules.TeamSize:
+		refuse("versus.team_size", g.Name, g.TeamSize, rules.TeamSize)
+		return
+	case g.Scenario != rules.Scenario:
+		refuse("versus.scenario", g.Name, g.Scenario.Name, rules.Scenario.Name)
+		return
+	case g.Difficulty != rules.Difficulty:
+		refuse("versus.difficulty", g.Name, DIFFICULTIES[g.Difficulty], DIFFICULTIES[rules.Difficulty])
+		return
+	case g.Modes() != rules.Modes:
+		refuse("versus.modes", g.Name, ModesText(g.Modes()), ModesText(rules.Modes))
+		return
+	}
+	g.Building = b
+	log.Printf("Games %s and %s are rivals", g.Name, other.Name)
+	for _, team := range b.Teams {
+		team := team
+		team.Post(func() { team.Rivals(b) }, nil)
+	}
+}
+
+// Unlink drops a rivalry that didn't happen and tells c why
+func (g *Game) Unlink(b *Building, c *Client, key string, args ...interface{}) {
+	if g.Building != b {
+		return
+	}
+	g.Building = nil
+	if g.Clients[c.Name] == c {
+		c.Tell(key, args...)
+	}
+	g.CheckFull()
+}
+
+// Rivals tells the team about the rivalry and starts the match if everyone
+// is already there
+func (g *Game) Rivals(b *Building) {
+	if g.Building != b {
+		return
+	}
+	g.MsgAll("versus.rivals", b.Teams[0].Name, b.Teams[1].Name)
+	if b.Limit > 0 {
+		g.MsgAll("versus.limit", b.Limit)
+	}
+	g.MsgAll("versus.when_full")
+	g.CheckFull()
+}
+
+// CallOff withdraws the game's challenge or ends its rivalry before the
+// match starts
+func (g *Game) CallOff() {
+	g.Challenges.Withdraw(g)
+	b := g.Building
+	if b == nil || !b.Leave() {
+		g.MsgAll("versus.none")
+		return
+	}
+	b.Broadcast(func(team *Game) {
+		if team.Building == b {
+			team.Building = nil
+			team.MsgAll("versus.called_off", g.Name)
+			team.CheckFull()
+		}
+	})
+}
+
+// Broadcast runs f for every team on its own goroutine
+func (b *Building) Broadcast(f func(team *Game)) {
+	for _, team := range b.Teams {
+		team := team
+		team.Post(func() { f(team) }, nil)
+	}
+}
+
+// VersusText describes the rivalry and challenges to c
+func (g *Game) VersusText(c *Client) string {
+	text := ""
+	b := g.Building
+	if b == nil {
+		text = c.Tr("versus.none")
+	} else {
+		b.mu.Lock()
+		text += c.Tr("versus.rival", b.Rival(g).Name)
+		if b.Limit > 0 {
+			text += c.Tr("versus.suspicion", b.Suspicion, b.Limit)
+		}
+		b.mu.Unlock()
+	}
+
+	from, rooms := g.Challenges.Of(g)
+	if from != "" {
+		text += c.Tr("versus.challenge_in", from)
+	}
+	for _, room := range rooms {
+		text += c.Tr("versus.challenge_out", room)
+	}
+	return text
+}
+
+// Ready records that g's team is full. Once every team is, the first team
+// deals the puzzle everyone plays.
+func (b *Building) Ready(g *Game) {
+	b.mu.Lock()
+	b.full[g] = true
+	all := len(b.full) == len(b.Teams)
+	b.mu.Unlock()
+	if all {
+		first := b.Teams[0]
+		first.Post(func() { b.Start(first) }, nil)
+	}
+}
+
+// Start deals the puzzle for the rules both teams agreed on and starts
+// every team, it runs on the first team's goroutine
+func (b *Building) Start(first *Game) {
+	b.mu.Lock()
+	if b.started || b.off {
+		b.mu.Unlock()
+		return
+	}
+	b.started = true
+	b.Puzzle = first.NewPuzzle()
+	b.mu.Unlock()
+	b.Broadcast(func(team *Game) { team.Init() })
+}
+
+// Rival returns the team playing against g
+func (b *Building) Rival(g *Game) *Game {
+	for _, team := range b.Teams {
+		if team != g {
+			return team
+		}
+	}
+	return nil
+}
+
+// Leave calls the match off if it has not started yet, the teams still
+// have to unlink themselves
+func (b *Building) Leave() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started {
+		return false
+	}
+	b.off = true
+	return true
+}
+
+// Claim gives f to g's team if no rival got it to Glenda first, and tells
+// the rivals it is gone. tripped is true if sending it went over the
+// building's suspicion limit.
+func (b *Building) Claim(g *Game, f File) (tripped bool, err error) {
+	b.mu.Lock()
+	if b.finished[g] {
+		b.mu.Unlock()
+		return false, T("versus.over")
+	}
+	if b.Lockdown {
+		b.mu.Unlock()
+		return false, T("versus.lockdown")
+	}
+	if team, ok := b.claimed[f.Filename]; ok {
+		b.mu.Unlock()
+		return false, T("versus.claimed", f.Filename, team.Name)
+	}
+	b.claimed[f.Filename] = g
+	b.Suspicion++
+	tripped = b.Limit > 0 && b.Suspicion > b.Limit
+	b.Lockdown = tripped
+	b.mu.Unlock()
+
+	for _, team := range b.Teams {
+		if team != g {
+			team.LostCh <- Loss{File: f.Filename, Team: g.Name}
+		}
+	}
+	if tripped {
+		b.Broadcast(func(team *Game) { team.MsgAll("versus.locked_down", g.Name) })
+	}
+	return tripped, nil
+}
+
+// Finish records that g has ended. Teams that finish first keep their
+// players waiting, the last one shows every team the results and ends them
+// all.
+func (b *Building) Finish(g *Game) {
+	if b.Leave() {
+		b.Broadcast(func(team *Game) {
+			if team.Building == b {
+				team.Building = nil
+				team.MsgAll("versus.left_early", g.Name)
+				team.CheckFull()
+			}
+		})
+		g.EndClients()
+		return
+	}
+	b.mu.Lock()
+	b.finished[g] = true
+	last := len(b.finished) == len(b.Teams)
+	b.mu.Unlock()
+	if !last {
+		g.MsgAll("versus.waiting")
+		return
+	}
+	// The other teams' games are over, nothing else touches them
+	for _, team := range b.Teams {
+		team.MsgEach(b.Results)
+		team.EndClients()
+	}
+}
+
+// Results ranks the teams for c, teams that were caught or left come last
+func (b *Building) Results(c *Client) string {
+	teams := make([]*Game, len(b.Teams))
+	copy(teams, b.Teams)
+	sort.SliceStable(teams, func(i, j int) bool {
+		if (teams[i].Status == RUNNING) != (teams[j].Status == RUNNING) {
+			return teams[i].Status == RUNNING
+		}
+		return teams[i].FinalScore() > teams[j].FinalScore()
+	})
+
+	text := c.Tr("versus.results")
+	for i, team := range teams {
+		state := T("versus.points", team.FinalScore())
+		switch team.Status {
+		case FAIL:
+			state = T("versus.caught")
+		case EXIT:
+			state = T("versus.left")
+		}
+		text += c.Tr("versus.result", i+1, team.Name, state)
+	}
+	return text
+}
+
+// A file a rival team got to Glenda first
+type Loss struct {
+	File string
+	Team string
+}
+
+// Lose takes a file a rival got to Glenda away from everyone on the team
+func (g *Game) Lose(l Loss) {
+	for _, c := range g.Clients {
+		for i, f := range c.Files {
+			if f.Filename == l.File {
+				c.Files = append(c.Files[:i], c.Files[i+1:]...)
+				break
+			}
+		}
+	}
+	g.MsgAll("versus.lost", l.Team, l.File)
+}
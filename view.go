@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+)
+
+// A TeamView is a copy of the team as it stands, made on the game's
+// goroutine for the goroutines that can't read the game itself: AI agents
+// and tab completion. Version goes up every time the team changes.
+type TeamView struct {
+	Game        string
+	Status      int
+	NPC         string
+	Agents      []AgentView // Ordered by name
+	Constraints []Constraint
+	Forbidden   map[string]bool // Files that would conflict with one Glenda has
+	Handoffs    bool
+	Version     int
+}
+
+type AgentView struct {
+	Name       string
+	AI         bool
+	Catalog    *Catalog
+	Files      []File
+	Bandwidth  int
+	Budgets    []int
+	Clearances []string
+	Handoffs   int
+	Done       bool
+}
+
+// View copies the team as it is now
+func (g *Game) View() TeamView {
+	v := TeamView{
+		Game:      g.Name,
+		Status:    g.Status,
+		NPC:       g.NPC(),
+		Agents:    make([]AgentView, 0, len(g.Clients)),
+		Forbidden: make(map[string]bool),
+		Handoffs:  g.Variants[HANDOFF_VARIANT],
+	}
+	for _, c := range g.SortedClients() {
+		v.Agents = append(v.Agents, AgentView{
+			Name:       c.Name,
+			AI:         c.AI != nil,
+			Catalog:    c.Catalog(),
+			Files:      append([]File(nil), c.Files...),
+			Bandwidth:  c.Bandwidth,
+			Budgets:    append([]int(nil), c.Budgets...),
+			Clearances: append([]string(nil), c.Clearances...),
+			Handoffs:   c.Handoffs,
+			Done:       c.DoneSendingFiles,
+		})
+		for _, f := range c.Files {
+			if g.Forbidden(f.Filename) {
+				v.Forbidden[f.Filename] = true
+			}
+		}
+	}
+	// Files tied to one Glenda already has count on their own now
+	for _, c := range g.Puzzle.Constraints {
+		if c.Kind == DEPENDS && (g.Received(c.Files[0]) || g.Received(c.Files[1])) {
+			continue
+		}
+		v.Constraints = append(v.Constraints, c)
+	}
+	return v
+}
+
+// Publish hands every player the view of the team if it changed since the
+// last one, and wakes the AI agents to look at it
+func (g *Game) Publish() {
+	v := g.View()
+	if g.view != nil {
+		v.Version = g.view.Version
+		if reflect.DeepEqual(v, *g.view) {
+			return
+		}
+		v.Version++
+	}
+	g.view = &v
+	for _, c := range g.Clients {
+		c.viewMu.Lock()
+		c.view = g.view
+		c.viewMu.Unlock()
+	}
+	g.NudgeAI()
+}
+
+// View is the last view of the team c was handed, nil before they join
+func (c *Client) View() *TeamView {
+	c.viewMu.Lock()
+	defer c.viewMu.Unlock()
+	return c.view
+}
+
+// Agent returns the agent called name
+func (v *TeamView) Agent(name string) (AgentView, bool) {
+	for _, a := range v.Agents {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return AgentView{}, false
+}
+
+// Solution solves the game from the view: the files still held by agents
+// that have not told Glenda they are done, and what is left of their
+// bandwidth and hand-offs.
+func (v *TeamView) Solution() Solution {
+	files := make([]File, 0)
+	agents := make([]Agent, 0)
+	for _, a := range v.Agents {
+		if a.Done {
+			continue
+		}
+		for _, f := range a.Files {
+			if !v.Forbidden[f.Filename] {
+				files = append(files, f)
+			}
+		}
+		agent := Agent{Name: a.Name, Capacity: a.Bandwidth, Budgets: a.Budgets, Clearances: a.Clearances}
+		if v.Handoffs {
+			for _, f := range a.Files {
+				agent.Holds = append(agent.Holds, f.Filename)
+			}
+			agent.Handoffs = a.Handoffs
+		}
+		agents = append(agents, agent)
+	}
+	return Solve(files, agents, v.Constraints...)
+}
+
+// Tr renders a message in the agent's language
+func (a AgentView) Tr(key string, args ...interface{}) string {
+	return a.Catalog.Text(key, args...)
+}